@@ -0,0 +1,101 @@
+/*
+Copyright © 2021 Tomoki Sugiura <cheztomo513@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/chez-shanpu/traffic-generator/pkg/file"
+	"github.com/chez-shanpu/traffic-generator/pkg/option"
+	"github.com/chez-shanpu/traffic-generator/pkg/sts"
+	"github.com/spf13/cobra"
+)
+
+// analyzeCmd represents the analyze command
+var analyzeCmd = &cobra.Command{
+	Use:   "analyze",
+	Short: "Analyze generated traffic data",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+// analyzePlanCmd represents the analyze plan command
+var analyzePlanCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Report how well a params file follows the planner distributions",
+	Long: `Report how well a params file follows the planner distributions.
+
+The summary statistics and the empirical CDF of the bitrate, send and wait durations are
+computed and tested against the distributions given by the same flags as tg init (or by
+--config) with the Kolmogorov-Smirnov and Anderson-Darling tests. The report has a table of
+quantiles of the empirical CDF next to the quantiles of the distribution. Send seconds are tested
+against the distribution rounded up to whole seconds like tg init does. The p-values are
+asymptotic, so they are rough for small numbers of cycles, and the Anderson-Darling test
+assumes continuous values, so it is strict on whole send seconds.`,
+	PreRunE: bindFlags,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg := option.Config{}
+		cfg.Populate()
+
+		s, err := sts.LoadSamples(cfg.Input)
+		if err != nil {
+			return err
+		}
+		// the planner only gives the distributions to test against
+		cfg.Cycle = len(s.SendSeconds)
+		p, err := sts.NewPlanner(cfg)
+		if err != nil {
+			return err
+		}
+		as := p.AnalyzePlan(s)
+
+		f, err := file.Create(cfg.Out)
+		if err != nil {
+			return err
+		}
+		switch cfg.Format {
+		case "text":
+			return sts.WriteText(f, as)
+		case "json":
+			e := json.NewEncoder(f)
+			e.SetIndent("", "  ")
+			return e.Encode(as)
+		default:
+			return fmt.Errorf("unknown format %q", cfg.Format)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(analyzeCmd)
+	analyzeCmd.AddCommand(analyzePlanCmd)
+
+	flags := analyzePlanCmd.Flags()
+	flags.StringP(option.Input, "i", "", "path to the params file")
+	flags.String(option.Format, "text", "report format (text, json)")
+	addPlannerFlags(flags)
+
+	_ = analyzePlanCmd.MarkFlagRequired(option.Input)
+}
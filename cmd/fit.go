@@ -0,0 +1,142 @@
+/*
+Copyright © 2021 Tomoki Sugiura <cheztomo513@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/chez-shanpu/traffic-generator/pkg/file"
+	"github.com/chez-shanpu/traffic-generator/pkg/option"
+	"github.com/chez-shanpu/traffic-generator/pkg/sts"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// fitCmd represents the fit command
+var fitCmd = &cobra.Command{
+	Use:   "fit",
+	Short: "Fit distributions to a params or results file and output a planner config",
+	Long: `Fit distributions to a params or results file and output a planner config.
+
+The bitrate, send and wait durations of the input are fitted to each candidate distribution
+by maximum likelihood. The send seconds of plans, which tg init rounds up to whole seconds, are
+fitted by the likelihood of the rounded values. The candidates are ranked by AIC and the
+Kolmogorov-Smirnov distance after the candidates which the Kolmogorov-Smirnov test does not
+reject at the 5% level, the ranking is reported on stderr and the best ones are written as a
+config which "tg init --config" reads.`,
+	PreRunE: bindFlags,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg := option.Config{}
+		cfg.Populate()
+
+		s, err := sts.LoadSamples(cfg.Input)
+		if err != nil {
+			return err
+		}
+
+		unit, scale := bitrateUnitOf(s.Bitrates)
+		bitrates := make([]float64, len(s.Bitrates))
+		for i, b := range s.Bitrates {
+			bitrates[i] = b / scale
+		}
+
+		conf := yaml.MapSlice{
+			{Key: option.Cycle, Value: len(s.SendSeconds)},
+			{Key: option.BitrateUnit, Value: unit},
+		}
+		for _, v := range []struct {
+			key     string
+			samples []float64
+			ceiled  bool
+		}{
+			{option.BitrateDist, bitrates, false},
+			{option.SendDist, s.SendSeconds, s.SendCeiled},
+			{option.WaitDist, s.WaitSeconds, false},
+		} {
+			fit := sts.Fit
+			if v.ceiled {
+				fit = sts.FitCeiled
+			}
+			rs, err := fit(v.samples, cfg.FitCandidates)
+			if err != nil {
+				return fmt.Errorf("%s: %w", v.key, err)
+			}
+			reportFit(v.key, rs)
+			conf = append(conf, yaml.MapItem{Key: v.key, Value: rs[0].Spec.String()})
+		}
+
+		b, err := yaml.Marshal(conf)
+		if err != nil {
+			return err
+		}
+		f, err := file.Create(cfg.Out)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(b)
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(fitCmd)
+
+	flags := fitCmd.Flags()
+	flags.StringP(option.Input, "i", "", "path to the params or results file")
+	flags.StringSlice(option.FitCandidates, sts.FitCandidates, "candidate distributions")
+
+	_ = fitCmd.MarkFlagRequired(option.Input)
+}
+
+// bitrateUnitOf returns the SI unit which suits the median of the bitrates.
+func bitrateUnitOf(bs []float64) (string, float64) {
+	if len(bs) == 0 {
+		return "", 1
+	}
+	s := append([]float64(nil), bs...)
+	sort.Float64s(s)
+	m := s[len(s)/2]
+
+	for _, u := range []struct {
+		unit  string
+		scale float64
+	}{{"G", 1e9}, {"M", 1e6}, {"K", 1e3}} {
+		if m >= u.scale {
+			return u.unit, u.scale
+		}
+	}
+	return "", 1
+}
+
+func reportFit(key string, rs []sts.FitResult) {
+	fmt.Fprintf(os.Stderr, "%s:\n", key)
+	for _, r := range rs {
+		rejected := ""
+		if r.Rejected {
+			rejected = "  rejected"
+		}
+		fmt.Fprintf(os.Stderr, "  %-50s AIC %12.3f  KS %.4f  p %.4f%s\n", r.Spec, r.AIC, r.KS, r.PValue, rejected)
+	}
+}
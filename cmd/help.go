@@ -0,0 +1,132 @@
+/*
+Copyright © 2021 Tomoki Sugiura <cheztomo513@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// The following commands are help topics, shown by tg help <topic>, for the syntax of the flags of tg init.
+
+var distributionsHelp = &cobra.Command{
+	Use:   "distributions",
+	Short: "Syntax of the distributions of the planner flags",
+	Long: `The planner flags ending in -dist draw their values from any of the following distributions
+given as <name>:<key>=<value>,... (e.g. --send-dist=pareto:xm=1,alpha=1.5).
+
+  constant     value
+  empirical    file (CSV of samples, or of value,cumulative-probability pairs)
+  exponential  rate
+  gamma        alpha, beta
+  lognormal    mu, sigma
+  normal       mu, sigma, min (default 0), max (default +Inf)
+  pareto       xm, alpha
+  poisson      lambda
+  uniform      min, max
+  weibull      k, lambda
+  workload     name, scale (default 1) of a built-in workload
+
+--workload draws the flow sizes or the bitrates of the plan from a built-in workload, an empirical
+distribution interpolated between the points of a CDF. The points are published ones, except for
+the synth- workloads, which are shaped by hand and only illustrate the environment they are named after:
+%s
+
+The source of each workload is reported on stderr.`,
+}
+
+var modelsHelp = &cobra.Command{
+	Use:   "models",
+	Short: "Models of the cycles of plans",
+	Long: `--model selects how the cycles of a plan are generated. The default renewal model draws every cycle
+independently from the distributions.
+
+With --model=mmpp the distributions switch with the state of a Markov chain given by --mmpp:
+
+  initial: idle
+  states:
+  - name: idle
+    bitrate-dist: constant:value=1
+    wait-dist: exponential:rate=0.1
+  - name: burst
+    bitrate-dist: pareto:xm=50,alpha=1.5
+    send-dist: exponential:rate=0.2
+  transitions:
+  - [0.9, 0.1]
+  - [0.3, 0.7]
+
+States without a distribution use --bitrate, --send-seconds and --wait-seconds if they are given,
+or else the distributions given by the flags, which must have finite means. The state of each cycle is
+written to the State column.
+
+With --model=selfsimilar the plan is long-range dependent with the Hurst parameter given by --hurst.
+Bitrates follow fractional Gaussian noise mapped onto the bitrate distribution unless --bitrate is
+given, and send and wait durations are Pareto ON/OFF periods with shape 3-2H whose means are
+--send-seconds and --wait-seconds, or the means of the send and wait distributions, which must be finite.
+The Hurst exponent estimated from the generated plan is reported on stderr.
+
+With --model=arrival the plan is an open-loop timeline of --cycle flows arriving as a poisson process
+with --arrival-rate flows per second, or as a renewal process with inter-arrival times drawn from
+--arrival-dist. Each flow is a single cycle with a bitrate and send duration drawn from their
+distributions, and starts at its arrival whether or not earlier flows are still running, so
+flows overlap. Run the plan with tg run --ports against tg server --ports to serve the overlapping
+flows from a pool of server ports.`,
+}
+
+var envelopesHelp = &cobra.Command{
+	Use:   "envelopes",
+	Short: "Syntax of the time-of-day profiles of --envelope",
+	Long: `--envelope modulates the plan by a time-of-day profile. The bitrate of each cycle is multiplied
+and its wait divided by the profile at the hour the cycle starts, where plan time is scaled by
+--time-compression. Every kind accepts start=<hour>, the hour of the day at which the plan starts.
+
+  sin:min=<m>,max=<m>,peak=<hour>   sinusoidal profile with a period of a day
+  csv:file=<path>                   piecewise-linear profile from hour,multiplier lines
+  step:<hour>=<m>,<hour>=<m>,...    step schedule
+
+The scheduled start offset of each cycle is written to the StartMilliSeconds column.`,
+}
+
+var constraintsHelp = &cobra.Command{
+	Use:   "constraints",
+	Short: "Constraints on the cycles and the totals of plans",
+	Long: `--send-min, --send-max, --bitrate-min, --bitrate-max, --max-duration and --target-bytes constrain
+the plan. --constraint-method selects how:
+
+  truncate  clamps cycles to their bounds, drops the cycles after --max-duration and shortens
+            the plan once --target-bytes is sent
+  reject    redraws cycles until they are within their bounds and the whole plan until it fits
+            --max-duration and --target-bytes within --target-tolerance
+  rescale   clamps cycles to their bounds, scales durations to fit --max-duration and then
+            bitrates to send --target-bytes within --target-tolerance, and fails if the
+            bounds do not allow it
+
+The Kolmogorov-Smirnov distance between the generated values and the requested distributions
+is reported on stderr.`,
+}
+
+func init() {
+	distributionsHelp.Long = fmt.Sprintf(distributionsHelp.Long, workloadHelp())
+	rootCmd.AddCommand(distributionsHelp, modelsHelp, envelopesHelp, constraintsHelp)
+}
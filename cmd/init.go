@@ -23,12 +23,18 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/chez-shanpu/traffic-generator/pkg/option"
 
 	"github.com/chez-shanpu/traffic-generator/pkg/sts"
+	"github.com/chez-shanpu/traffic-generator/pkg/traffic"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
@@ -36,33 +42,210 @@ import (
 var initCmd = &cobra.Command{
 	Use:   "init",
 	Short: "Generate traffic data and output",
+	Long: `Generate traffic data and output.
+
+Bitrates and send and wait durations are drawn from the distributions given by --bitrate-dist,
+--send-dist and --wait-dist, or from the poisson and exponential distributions of the lambdas.
+--workload draws flow sizes or bitrates from a built-in workload. See tg help distributions.
+
+--model selects how the cycles are generated, independently (renewal, the default), by a Markov
+chain of states (mmpp), long-range dependent (selfsimilar) or as an open-loop timeline of flow
+arrivals (arrival). See tg help models.
+
+--envelope modulates the plan by a time-of-day profile and the bounds and totals given by
+--send-min, --send-max, --bitrate-min, --bitrate-max, --max-duration and --target-bytes constrain
+it. See tg help envelopes and tg help constraints.
+
+--size-dist makes the cycles send flows of a given size instead of sending for a duration. The size
+in bytes is written to the FlowBytes column and tg run sends it with iperf3 -n. SendSeconds is then
+the time expected to send the flow at its bitrate, and the results report the completion time of
+every flow measured by iperf3 (FlowCompletionSecond) and the time iperf3 ran (WallSecond).
+
+The plan is written as CSV, or as JSON or YAML with a metadata header holding the schema version,
+the seed, the model, the flags and the version of tg, so that the plan can be reproduced. --format
+selects the format, which is otherwise given by the extension of --out. tg run reads all of them.
+
+--flows generates a plan of independent flows which tg run executes concurrently. Each flow draws
+its own random streams from --seed, and the entries of the flow-overrides list of the config file
+override the settings of the corresponding flow, including its destination:
+
+  flow-overrides:
+  - send-dist: pareto:xm=1,alpha=1.5
+    dst-port: 5202
+  - bitrate: 10M
+    dst-addr: 192.0.2.10
+
+--from-pcap derives the plan from a pcap or pcapng file instead. Packets are grouped into flows
+by their 5-tuple and every ON period of a flow, ended by a gap longer than --idle-gap, becomes
+a cycle sending the bytes of the period. The largest --pcap-flows flows are written as the flows
+of the plan.`,
+	PreRunE: bindPlannerFlags,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cfg := option.Config{}
 		cfg.Populate()
 
-		p := sts.NewPlanner(cfg)
-		ps := p.GenerateTrafficParams()
+		if cfg.FromPcap != "" {
+			return initFromPcap(cmd, cfg)
+		}
+
+		cfgs, err := cfg.FlowConfigs(cfg.Flows)
+		if err != nil {
+			return err
+		}
+		planners, err := sts.NewFlowPlanners(cfgs)
+		if err != nil {
+			return err
+		}
+		fs, err := sts.GenerateFlows(planners)
+		if err != nil {
+			return err
+		}
 
-		return ps.Output(cfg.Out)
+		for i, p := range planners {
+			if len(planners) > 1 {
+				fmt.Fprintf(os.Stderr, "flow %d:\n", p.Flow)
+			}
+			reportPlan(p, fs[i])
+		}
+
+		if cfg.Workload != "" {
+			w, err := sts.LookupWorkload(cfg.Workload)
+			if err != nil {
+				return err
+			}
+			if w.Synthetic {
+				fmt.Fprintf(os.Stderr, "workload %s: synthetic\n", w.Name)
+			} else {
+				fmt.Fprintf(os.Stderr, "workload %s: %s\n", w.Name, w.Citation)
+			}
+			if w.Note != "" {
+				fmt.Fprintf(os.Stderr, "  %s\n", w.Note)
+			}
+		}
+
+		plan := &traffic.Plan{Metadata: planMetadata(cmd, cfg), Cycles: sts.MergeFlows(planners, fs)}
+		return plan.Output(cfg.Out, cfg.Format)
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(initCmd)
 
-	flags := initCmd.Flags()
+	addPlannerFlags(initCmd.Flags())
+	initCmd.Flags().Int(option.Flows, 1, "number of concurrent flows")
+	initCmd.Flags().String(option.Format, "", "format of the params file (csv, json, yaml), by default given by the extension of --out")
+	initCmd.Flags().String(option.FromPcap, "", "derive the plan from the flows of a pcap or pcapng file")
+	initCmd.Flags().Float64(option.IdleGap, sts.DefaultIdleGap.Seconds(), "gap seconds between packets of a flow which ends an ON period, used by --from-pcap")
+	initCmd.Flags().Int(option.PcapFlows, 1, "number of the largest flows written by --from-pcap (0 for all)")
+
+	_ = initCmd.MarkFlagRequired(option.Cycle)
+}
+
+// bindPlannerFlags binds the flags of a command which generates plans. --cycle is not required when the
+// config file gives it or the plan is derived from a capture.
+func bindPlannerFlags(cmd *cobra.Command, args []string) error {
+	if err := bindFlags(cmd, args); err != nil {
+		return err
+	}
+	if viper.InConfig(option.Cycle) || viper.GetString(option.FromPcap) != "" {
+		return cmd.Flags().SetAnnotation(option.Cycle, cobra.BashCompOneRequiredFlag, []string{"false"})
+	}
+	return nil
+}
+
+// addPlannerFlags adds the flags which configure sts.Planner.
+func addPlannerFlags(flags *pflag.FlagSet) {
 	flags.Int(option.Cycle, 0, "number of traffic generation cycles")
+	flags.String(option.Model, sts.ModelRenewal, "traffic model (renewal, mmpp, selfsimilar, arrival)")
+	flags.Float64(option.Hurst, 0, "target Hurst parameter in (0, 1) used by --model=selfsimilar")
+	flags.Float64(option.ArrivalRate, 0, "flow arrivals per second of the poisson process used by --model=arrival")
+	flags.String(option.ArrivalDist, "", "distribution of inter-arrival seconds used by --model=arrival, overrides --arrival-rate")
+	flags.String(option.Envelope, "", "time-of-day envelope which scales bitrates and waits (e.g. sin:min=0.2,max=1,peak=14)")
+	flags.Float64(option.TimeCompression, 1, "time compression factor of the envelope (e.g. 24 plays a day in an hour)")
+	flags.String(option.MarkovModel, "", "path to the Markov-modulated model file used by --model=mmpp")
 	flags.Uint64(option.Seed, uint64(time.Now().UnixNano()), "seed for random values")
+	flags.String(option.Correlation, "", "correlation between the bitrate, send and wait streams (e.g. bitrate:send=0.5,send:wait=-0.3)")
 	flags.Float64(option.SendLambda, 0, "lambda of exponential distribution for send duration")
+	flags.String(option.SendDist, "", "distribution of send duration seconds (e.g. pareto:xm=1,alpha=1.5), overrides --send-lambda")
 	flags.Int64(option.SendSeconds, 0, "send duration seconds")
 	flags.Float64(option.WaitLambda, 0, "lambda of exponential distribution for wait duration")
+	flags.String(option.WaitDist, "", "distribution of wait duration seconds (e.g. lognormal:mu=0,sigma=1), overrides --wait-lambda")
 	flags.Int64(option.WaitSeconds, 0, "wait duration seconds")
-	flags.String(option.Bitrate, "", "traffic bitrate")
+	flags.String(option.Bitrate, "", "traffic bitrate (e.g. 100M, 1.5G, 512Ki)")
 	flags.Float64(option.BitrateLambda, 0, "lambda of poisson distribution for bitrate")
+	flags.String(option.BitrateDist, "", "distribution of bitrate in bitrate-unit (e.g. uniform:min=10,max=100), overrides --bitrate-lambda")
 	flags.String(option.BitrateUnit, "", "bitrate unit (e.g. K,M,G)")
+	flags.String(option.BitrateMin, "", "minimum of random bitrates (default 1 bitrate-unit)")
+	flags.String(option.BitrateMax, "", "maximum of random bitrates (default unlimited)")
+	flags.String(option.Workload, "", "built-in workload drawing flow sizes or bitrates (e.g. websearch)")
+	flags.String(option.SizeDist, "", "distribution of flow sizes in bytes (e.g. lognormal:mu=10,sigma=2), which replaces send durations")
+	flags.Int64(option.SendMin, 0, "minimum of random send seconds")
+	flags.Int64(option.SendMax, 0, "maximum of random send seconds (default unlimited)")
+	flags.Float64(option.MaxDuration, 0, "maximum total duration seconds of the plan (default unlimited)")
+	flags.Int64(option.TargetBytes, 0, "target total bytes of the plan")
+	flags.Float64(option.TargetTolerance, 0.05, "relative tolerance of --target-bytes for --constraint-method=reject and rescale")
+	flags.String(option.ConstraintMethod, sts.ConstraintTruncate, "how constraints are enforced (truncate, reject, rescale)")
+}
+
+func initFromPcap(cmd *cobra.Command, cfg option.Config) error {
+	idle := time.Duration(cfg.IdleGap * float64(time.Second))
+	t, err := sts.LoadTrace(cfg.FromPcap, idle)
+	if err != nil {
+		return err
+	}
 
-	_ = viper.BindPFlags(flags)
+	flows := t.Flows
+	if cfg.PcapFlows > 0 && cfg.PcapFlows < len(flows) {
+		flows = flows[:cfg.PcapFlows]
+	}
+
+	var ps traffic.Params
+	for i, f := range flows {
+		fmt.Fprintf(os.Stderr, "flow %d: %s, %d packets, %d bytes, %d ON periods\n", i, f.Key, f.Packets, f.Bytes, len(f.Bursts))
+		fs := f.Params(t.Start)
+		for _, p := range fs {
+			p.Flow = i
+		}
+		ps = append(ps, fs...)
+	}
+	sort.SliceStable(ps, func(i, j int) bool {
+		return ps[i].StartMilliSeconds < ps[j].StartMilliSeconds
+	})
+	md := planMetadata(cmd, cfg)
+	md.Model = "pcap"
+	plan := &traffic.Plan{Metadata: md, Cycles: ps}
+	return plan.Output(cfg.Out, cfg.Format)
+}
+
+func workloadHelp() string {
+	var b strings.Builder
+	for _, w := range sts.Workloads() {
+		fmt.Fprintf(&b, "\n  %-14s %-8s %s", w.Name, w.Parameter, w.Description)
+	}
+	return b.String()
+}
+
+func reportPlan(p *sts.Planner, ps traffic.Params) {
+	if p.Model == sts.ModelSelfSimilar {
+		h, err := sts.EstimateHurst(sts.RateSeries(ps))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[WARN] %v\n", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "estimated Hurst exponent %.3f (target %.3f)\n", h, p.Hurst)
+		}
+	}
+	reportConstraints(p, ps)
+}
 
-	_ = rootCmd.MarkFlagRequired(option.Cycle)
-	_ = rootCmd.MarkFlagRequired(option.Bitrate)
+func reportConstraints(p *sts.Planner, ps traffic.Params) {
+	c := p.Constraints
+	if c.MaxDuration > 0 {
+		fmt.Fprintf(os.Stderr, "total duration %.3f sec (max %.3f sec)\n", float64(ps.Duration())/1000, float64(c.MaxDuration)/1000)
+	}
+	if c.TargetBytes > 0 {
+		fmt.Fprintf(os.Stderr, "total bytes %d (target %d)\n", ps.TotalBytes(), c.TargetBytes)
+	}
+	for _, d := range p.Deviations(ps) {
+		fmt.Fprintf(os.Stderr, "%s: Kolmogorov-Smirnov distance %.4f from the requested distribution\n", d.Param, d.KS)
+	}
 }
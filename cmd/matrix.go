@@ -0,0 +1,132 @@
+/*
+Copyright © 2021 Tomoki Sugiura <cheztomo513@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/chez-shanpu/traffic-generator/pkg/option"
+	"github.com/chez-shanpu/traffic-generator/pkg/sts"
+	"github.com/chez-shanpu/traffic-generator/pkg/traffic"
+	"github.com/spf13/cobra"
+)
+
+// initMatrixCmd represents the init matrix command
+var initMatrixCmd = &cobra.Command{
+	Use:   "matrix",
+	Short: "Generate traffic data between many endpoints",
+	Long: `Generate traffic data between many endpoints.
+
+The endpoints are given by --endpoints or by --endpoints-file, a file of address[,weight] lines.
+--matrix selects how sources spread their traffic over the destinations:
+
+  uniform      every source sends to the other endpoints alike
+  gravity      sources send in proportion to their weight, to destinations in proportion to theirs
+  hotspot      sources send --hotspot-fraction of their traffic to the first --hotspots endpoints
+  permutation  every source sends to a single destination of a random permutation
+  all-to-all   every source sends to every other endpoint at once
+
+Every source is a flow generated by the planner flags of tg init whose cycles go to destinations
+drawn from the matrix, except for all-to-all where every pair is a flow of its own. The SrcAddr
+column holds the source of every cycle. Sources send to port --dst-port plus their index, so every
+endpoint receives from all sources with tg server --ports <dst-port>-<dst-port + endpoints - 1>.
+
+The plan is written to a single file, or with --per-source to a file named <out>-<source> for each
+source, which tg run executes on the source host. tg run --src-addr runs the cycles of one source
+of a single file.`,
+	PreRunE: bindPlannerFlags,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg := option.Config{}
+		cfg.Populate()
+
+		eps := sts.ParseEndpoints(cfg.Endpoints)
+		if cfg.EndpointsFile != "" {
+			fe, err := sts.LoadEndpoints(cfg.EndpointsFile)
+			if err != nil {
+				return err
+			}
+			eps = append(eps, fe...)
+		}
+		m, err := sts.NewMatrix(cfg.Matrix, eps, cfg.Hotspots, cfg.HotspotFraction, cfg.Seed)
+		if err != nil {
+			return err
+		}
+		basePort, err := strconv.Atoi(cfg.DstPort)
+		if err != nil {
+			return fmt.Errorf("invalid port %q", cfg.DstPort)
+		}
+
+		ps, err := m.Generate(cfg, basePort)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "%s traffic matrix of %d endpoints, %d cycles\n", m.Model, len(eps), len(ps))
+
+		md := planMetadata(cmd, cfg)
+		if !cfg.PerSource {
+			plan := &traffic.Plan{Metadata: md, Cycles: ps}
+			return plan.Output(cfg.Out, cfg.Format)
+		}
+		if cfg.Out == "" {
+			return fmt.Errorf("--%s is required with --%s", option.Out, option.PerSource)
+		}
+		ext := filepath.Ext(cfg.Out)
+		for _, ep := range eps {
+			var sps traffic.Params
+			for _, p := range ps {
+				if p.SrcAddr == ep.Addr {
+					sps = append(sps, p)
+				}
+			}
+			// IPv6 addresses are not valid in file names on every system
+			name := strings.ReplaceAll(ep.Addr, ":", "_")
+			out := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(cfg.Out, ext), name, ext)
+			plan := &traffic.Plan{Metadata: md, Cycles: sps}
+			if err := plan.Output(out, cfg.Format); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	initCmd.AddCommand(initMatrixCmd)
+
+	flags := initMatrixCmd.Flags()
+	addPlannerFlags(flags)
+	flags.StringSlice(option.Endpoints, nil, "comma separated addresses of the endpoints")
+	flags.String(option.EndpointsFile, "", "path to a file of address[,weight] lines of the endpoints")
+	flags.String(option.Matrix, sts.MatrixUniform, "traffic matrix (uniform, gravity, hotspot, permutation, all-to-all)")
+	flags.Int(option.Hotspots, 1, "number of hotspot endpoints of --matrix=hotspot")
+	flags.Float64(option.HotspotFraction, 0.8, "share of the traffic sent to the hotspots by --matrix=hotspot")
+	flags.StringP(option.DstPort, "p", "5201", "port of the first source, which the other sources follow")
+	flags.Bool(option.PerSource, false, "write the plan of each source to its own file")
+	flags.String(option.Format, "", "format of the params file (csv, json, yaml), by default given by the extension of --out")
+
+	_ = initMatrixCmd.MarkFlagRequired(option.Cycle)
+}
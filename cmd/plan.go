@@ -0,0 +1,291 @@
+/*
+Copyright © 2021 Tomoki Sugiura <cheztomo513@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chez-shanpu/traffic-generator/pkg/option"
+	"github.com/chez-shanpu/traffic-generator/pkg/traffic"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// planCmd represents the plan command
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Transform params files",
+	Long: `Transform params files.
+
+Every subcommand writes a new plan and leaves its input alone. The metadata of the input plan is
+kept and the transformation is appended to its transforms list, so that a JSON or YAML plan tells
+how it was derived. Start offsets of the output are the times at which tg run starts every cycle.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+// planScaleCmd represents the plan scale command
+var planScaleCmd = &cobra.Command{
+	Use:   "scale",
+	Short: "Scale the bitrates, send durations and waits of a plan",
+	Long: `Scale the bitrates, send durations and waits of a plan.
+
+--bitrate-factor multiplies the bitrates, --send-factor the send durations and flow sizes and
+--wait-factor the waits and the time before the first cycle of every flow. Send durations are
+rounded up to whole seconds. E.g. --bitrate-factor 2 is the same plan at twice the rate.`,
+	PreRunE: bindFlags,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg := option.Config{}
+		cfg.Populate()
+
+		t := fmt.Sprintf("scale bitrate=%v send=%v wait=%v", cfg.BitrateFactor, cfg.SendFactor, cfg.WaitFactor)
+		return transformPlan(cfg, t, func(ps traffic.Params) (traffic.Params, error) {
+			return ps.Scale(cfg.BitrateFactor, cfg.SendFactor, cfg.WaitFactor)
+		})
+	},
+}
+
+// planCompressCmd represents the plan compress command
+var planCompressCmd = &cobra.Command{
+	Use:   "compress",
+	Short: "Shorten the runtime of a plan",
+	Long: `Shorten the runtime of a plan.
+
+Send durations and the idle times before every cycle are divided by --time-compression and bitrates
+multiplied by it, so that every cycle sends about as many bytes in less time. Send durations are
+rounded up to whole seconds of at least 1, and the bitrate of a cycle is adjusted to send its bytes
+in the rounded duration. Start offsets follow from the rounded durations. Plans whose runtime would
+miss the factor by more than 10%, such as plans of 1 second cycles, are refused.`,
+	PreRunE: bindFlags,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg := option.Config{}
+		cfg.Populate()
+
+		t := fmt.Sprintf("compress factor=%v", cfg.TimeCompression)
+		return transformPlan(cfg, t, func(ps traffic.Params) (traffic.Params, error) {
+			return ps.Compress(cfg.TimeCompression)
+		})
+	},
+}
+
+// planSliceCmd represents the plan slice command
+var planSliceCmd = &cobra.Command{
+	Use:   "slice",
+	Short: "Cut a range of cycles or a time window out of a plan",
+	Long: `Cut a range of cycles or a time window out of a plan.
+
+--cycles selects cycles by their number, as in the Cycle column of CSV files, both ends included
+(e.g. 100-200, or 100- for the cycles from 100 on). --time-window selects the cycles which start
+within a window of seconds from the start of the plan, the end excluded (e.g. 60-120). The output
+starts at the first selected cycle or at the start of the window.`,
+	PreRunE: bindFlags,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg := option.Config{}
+		cfg.Populate()
+
+		switch {
+		case cfg.Cycles != "" && cfg.TimeWindow != "":
+			return fmt.Errorf("--%s and --%s are exclusive", option.Cycles, option.TimeWindow)
+		case cfg.Cycles != "":
+			from, to, err := parseRange(cfg.Cycles)
+			if err != nil {
+				return fmt.Errorf("invalid --%s: %w", option.Cycles, err)
+			}
+			return transformPlan(cfg, "slice cycles="+cfg.Cycles, func(ps traffic.Params) (traffic.Params, error) {
+				return ps.SliceCycles(int(from), int(to))
+			})
+		case cfg.TimeWindow != "":
+			from, to, err := parseRange(cfg.TimeWindow)
+			if err != nil {
+				return fmt.Errorf("invalid --%s: %w", option.TimeWindow, err)
+			}
+			if to >= 0 {
+				to *= 1000
+			}
+			return transformPlan(cfg, "slice time-window="+cfg.TimeWindow, func(ps traffic.Params) (traffic.Params, error) {
+				return ps.SliceTime(traffic.MilliSecond(from*1000), traffic.MilliSecond(to))
+			})
+		}
+		return fmt.Errorf("--%s or --%s is required", option.Cycles, option.TimeWindow)
+	},
+}
+
+// planShuffleCmd represents the plan shuffle command
+var planShuffleCmd = &cobra.Command{
+	Use:   "shuffle",
+	Short: "Randomly reorder the cycles of a plan",
+	Long: `Randomly reorder the cycles of a plan.
+
+The cycles of every flow are shuffled with --seed and scheduled again from the start of the flow,
+so that the plan keeps its cycles but loses the order, e.g. the correlation between consecutive
+cycles.`,
+	PreRunE: bindFlags,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg := option.Config{}
+		cfg.Populate()
+
+		t := fmt.Sprintf("shuffle seed=%d", cfg.Seed)
+		return transformPlan(cfg, t, func(ps traffic.Params) (traffic.Params, error) {
+			return ps.Shuffle(cfg.Seed), nil
+		})
+	},
+}
+
+// planConcatCmd represents the plan concat command
+var planConcatCmd = &cobra.Command{
+	Use:   "concat",
+	Short: "Run plans one after another",
+	Long: `Run plans one after another.
+
+The plans of --params are joined so that every plan starts when the previous ones have ended.
+Flows keep their numbers, so that a flow continues the flow of the same number of the previous
+plan. The metadata is the one of the first plan.`,
+	PreRunE: bindFlags,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg := option.Config{}
+		cfg.Populate()
+
+		return combinePlans(cfg, "concat", traffic.Concat)
+	},
+}
+
+// planInterleaveCmd represents the plan interleave command
+var planInterleaveCmd = &cobra.Command{
+	Use:   "interleave",
+	Short: "Run plans concurrently",
+	Long: `Run plans concurrently.
+
+The cycles of the plans of --params are merged in the order of their start offsets, and the flows
+of every plan are numbered after the flows of the previous plans, so that tg run runs the plans
+side by side. The metadata is the one of the first plan.`,
+	PreRunE: bindFlags,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg := option.Config{}
+		cfg.Populate()
+
+		return combinePlans(cfg, "interleave", traffic.Interleave)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(planCmd)
+
+	planScaleCmd.Flags().Float64(option.BitrateFactor, 1, "factor of the bitrates")
+	planScaleCmd.Flags().Float64(option.SendFactor, 1, "factor of the send durations and flow sizes")
+	planScaleCmd.Flags().Float64(option.WaitFactor, 1, "factor of the waits")
+	planCompressCmd.Flags().Float64(option.TimeCompression, 1, "how many times shorter the runtime of the plan is made")
+	planSliceCmd.Flags().String(option.Cycles, "", "range of cycles to keep (e.g. 100-200)")
+	planSliceCmd.Flags().String(option.TimeWindow, "", "window of start seconds of the cycles to keep (e.g. 60-120)")
+	planShuffleCmd.Flags().Uint64(option.Seed, uint64(time.Now().UnixNano()), "seed for the shuffle")
+
+	for _, c := range []*cobra.Command{planScaleCmd, planCompressCmd, planSliceCmd, planShuffleCmd} {
+		c.Flags().String(option.Param, "", "path to the param file")
+		addPlanOutputFlags(c.Flags())
+		_ = c.MarkFlagRequired(option.Param)
+		planCmd.AddCommand(c)
+	}
+	for _, c := range []*cobra.Command{planConcatCmd, planInterleaveCmd} {
+		c.Flags().StringSlice(option.Params, nil, "paths to the param files, in order")
+		addPlanOutputFlags(c.Flags())
+		_ = c.MarkFlagRequired(option.Params)
+		planCmd.AddCommand(c)
+	}
+}
+
+func addPlanOutputFlags(flags *pflag.FlagSet) {
+	flags.String(option.Format, "", "format of the params file (csv, json, yaml), by default given by the extension of --out")
+}
+
+// transformPlan writes the plan of --param transformed by f, recording the transformation t in its metadata.
+func transformPlan(cfg option.Config, t string, f func(ps traffic.Params) (traffic.Params, error)) error {
+	p, err := traffic.LoadPlan(cfg.Param)
+	if err != nil {
+		return err
+	}
+	ps, err := f(p.Cycles)
+	if err != nil {
+		return err
+	}
+
+	res := &traffic.Plan{Metadata: transformedMetadata(p.Metadata, t), Cycles: ps}
+	return res.Output(cfg.Out, cfg.Format)
+}
+
+// combinePlans writes the plans of --params combined by f.
+func combinePlans(cfg option.Config, name string, f func(plans ...traffic.Params) traffic.Params) error {
+	if len(cfg.Params) < 2 {
+		return fmt.Errorf("--%s requires at least 2 plans", option.Params)
+	}
+	var md traffic.Metadata
+	var plans []traffic.Params
+	for i, path := range cfg.Params {
+		p, err := traffic.LoadPlan(path)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			md = p.Metadata
+		}
+		plans = append(plans, p.Cycles)
+	}
+
+	t := fmt.Sprintf("%s params=%s", name, strings.Join(cfg.Params, ","))
+	res := &traffic.Plan{Metadata: transformedMetadata(md, t), Cycles: f(plans...)}
+	return res.Output(cfg.Out, cfg.Format)
+}
+
+// transformedMetadata returns the metadata of a plan with the transformation t appended. Plans without
+// metadata, such as CSV plans, get the metadata of this version of tg.
+func transformedMetadata(md traffic.Metadata, t string) traffic.Metadata {
+	if md.SchemaVersion == 0 {
+		md.ToolVersion = Version
+		md.GeneratedAt = time.Now().UTC()
+	}
+	md.SchemaVersion = traffic.SchemaVersion
+	md.Transforms = append(append([]string(nil), md.Transforms...), t)
+	return md
+}
+
+// parseRange parses a range such as 100-200, 100- or -200 into its ends. An open end is -1.
+func parseRange(s string) (from, to float64, err error) {
+	i := strings.Index(s, "-")
+	if i < 0 {
+		return 0, 0, fmt.Errorf("%q is not a range such as 100-200", s)
+	}
+	from, to = 0, -1
+	if a := s[:i]; a != "" {
+		if from, err = strconv.ParseFloat(a, 64); err != nil || from < 0 {
+			return 0, 0, fmt.Errorf("%q is not a range such as 100-200", s)
+		}
+	}
+	if b := s[i+1:]; b != "" {
+		if to, err = strconv.ParseFloat(b, 64); err != nil || to < from {
+			return 0, 0, fmt.Errorf("%q is not a range such as 100-200", s)
+		}
+	}
+	return from, to, nil
+}
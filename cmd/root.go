@@ -23,31 +23,119 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/chez-shanpu/traffic-generator/pkg/option"
+	"github.com/chez-shanpu/traffic-generator/pkg/traffic"
+	"github.com/spf13/cast"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 
 	"github.com/spf13/cobra"
 )
 
+// Version is the version of tg, set at build time.
+var Version = "dev"
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
-	Use:   "tg",
-	Short: "tg is a traffic generator",
+	Use:     "tg",
+	Short:   "tg is a traffic generator",
+	Version: Version,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return cmd.Help()
 	},
 }
 
 func init() {
+	cobra.OnInitialize(initConfig)
+
 	pflags := rootCmd.PersistentFlags()
 	pflags.StringP(option.Out, "o", "", "path to the output file (if this value is empty the results will be output to stdout)")
+	pflags.String(option.ConfigFile, "", "path to a config file whose keys are flag names (e.g. the output of tg fit)")
 
 	_ = viper.BindPFlags(pflags)
 }
 
+// initConfig reads the config file, whose values are used for the flags which are not set.
+func initConfig() {
+	path := viper.GetString(option.ConfigFile)
+	if path == "" {
+		return
+	}
+
+	viper.SetConfigFile(path)
+	if err := viper.ReadInConfig(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// bindFlags binds the flags of the command being run to viper, so that commands can share flag names.
+func bindFlags(cmd *cobra.Command, args []string) error {
+	return viper.BindPFlags(cmd.Flags())
+}
+
+// planMetadata returns the metadata of a plan generated by the command with its flags.
+func planMetadata(cmd *cobra.Command, cfg option.Config) traffic.Metadata {
+	settings := map[string]string{}
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		switch f.Name {
+		case option.Out, option.ConfigFile, option.Format, "help":
+			return
+		}
+		var v string
+		switch x := viper.Get(f.Name).(type) {
+		case []string:
+			v = strings.Join(x, ",")
+		default:
+			v = cast.ToString(x)
+		}
+		if v != "" {
+			settings[f.Name] = v
+		}
+	})
+
+	return traffic.Metadata{
+		SchemaVersion: traffic.SchemaVersion,
+		ToolVersion:   Version,
+		GeneratedAt:   time.Now().UTC(),
+		Seed:          cfg.Seed,
+		Model:         cfg.Model,
+		Settings:      settings,
+	}
+}
+
+// interruptContext returns a context which is done on SIGINT or SIGTERM, so that a run can stop
+// and write the results so far.
+func interruptContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// interrupted returns an error if the run was interrupted, so that tg exits with a failure.
+func interrupted(cmd *cobra.Command, ctx context.Context) error {
+	if ctx.Err() != nil {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("the run was interrupted")
+	}
+	return nil
+}
+
+// failed returns an error if more cycles failed than --max-failures allows, so that tg exits with a failure.
+func failed(cmd *cobra.Command, cfg option.Config, rs traffic.Results) error {
+	if n := rs.Failures(); cfg.MaxFailures >= 0 && n > cfg.MaxFailures {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("%d cycles failed, more than --%s=%d", n, option.MaxFailures, cfg.MaxFailures)
+	}
+	return nil
+}
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
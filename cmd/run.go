@@ -23,16 +23,65 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/chez-shanpu/traffic-generator/pkg/iperf3"
 	"github.com/chez-shanpu/traffic-generator/pkg/option"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
+	"github.com/spf13/pflag"
 )
 
 // runCmd represents the run command
 var runCmd = &cobra.Command{
 	Use:   "run",
 	Short: "Run traffic generator and out put its results",
+	Long: `Run traffic generator and out put its results.
+
+The flows of a multi-flow plan run concurrently. Cycles without a destination in the plan are sent
+to --dst-addr, and the flows of a multi-flow plan to consecutive ports from --dst-port (default 5201),
+which tg server --ports can listen on. With --ports, cycles take a free port of the pool instead,
+waiting for one when all are busy, which suits plans of many overlapping flows. Plans of more flows
+than ports above --dst-port, such as those of --model=arrival, are refused without --ports. Results are reported per cycle, per flow and in total.
+
+The optional Protocol (tcp or udp), Mss, Window, Parallel, TOS, Flowlabel and Reverse columns of the
+params file override the corresponding flags for their cycle, so that one plan can mix TCP bulk
+transfers and UDP streams. Empty cells keep the flags, while Mss and Flowlabel of 0 and Reverse of
+false turn the options off. The bitrate of a cycle is divided among its parallel streams, as
+iperf3 applies -b to every stream.
+
+Every cycle starts at its planned time on the timeline of the plan, its start offset or the end of
+the wait after the previous cycle of its flow, whichever is later, so that the time iperf3 takes to
+connect and finish is absorbed by the waits instead of accumulating over the plan. When the run
+falls behind anyway, cycles which start more than --max-lag seconds late are run right away
+(--lag-policy=run), skipped (skip), or shortened so that they end when they were planned to end
+(compress). The results have the planned and the actual start and the status of every cycle.
+
+Cycles which iperf3 fails to run get the status of the failure, connect-refused, server-busy,
+timeout, parse-error or error, and the error iperf3 reported. They are kept in the results and
+the run goes on (--on-failure=skip), run again up to --retries times with a backoff doubling
+from --retry-backoff seconds (retry), or stop the run (abort). tg exits with a failure when more
+than --max-failures cycles failed.
+
+iperf3 gives up connecting to the server after --connect-timeout seconds. A cycle whose iperf3 is
+still running 10 seconds after its send duration and the connect timeout, twice the send duration
+for cycles which send a flow size, is stopped with the timeout status, so that a hung iperf3 does
+not hang its flow. A run interrupted during the backoff before a retry marks the cycle interrupted.
+
+The result of every cycle is written to --out as soon as the cycle ends, so that the results of a
+long run can be followed with tail -f and are kept if tg crashes. Rows are in the order in which
+cycles end. The totals are appended at the end of the run, or written to --summary instead.
+
+The plan is validated like tg validate does before any cycle runs.
+
+On SIGINT or SIGTERM the running iperf3 processes are interrupted and no more cycles start. The
+results of the cycles run so far are written, the interrupted cycles with the interrupted status.
+
+Every completed cycle is recorded in a checkpoint file, --checkpoint or --out with a .checkpoint
+suffix, which is removed when the run completes. A run which was interrupted or died, for example
+on a reboot of the host, continues from the next cycles with --resume and the same plan, keeping
+the results of the cycles run before in --out. The rest of the plan starts right away.`,
+	PreRunE: bindFlags,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cfg := option.Config{}
 		cfg.Populate()
@@ -42,12 +91,64 @@ var runCmd = &cobra.Command{
 			return err
 		}
 
-		rs, err := c.GenerateTraffic()
-		if err != nil {
+		path := checkpointPath(cfg)
+		if cfg.Resume {
+			if path == "" {
+				return fmt.Errorf("--%s needs --%s or --%s", option.Resume, option.Checkpoint, option.Out)
+			}
+			if c.Checkpoint, err = iperf3.LoadCheckpoint(path, c.Params); err != nil {
+				return err
+			}
+		} else if path != "" {
+			if c.Checkpoint, err = iperf3.NewCheckpoint(path, c.Params); err != nil {
+				return err
+			}
+		}
+		if c.Checkpoint != nil {
+			defer c.Checkpoint.Close()
+		}
+
+		if c.Sink, err = c.NewResultWriter(cfg.Out); err != nil {
 			return err
 		}
+		defer c.Sink.Close()
+		if c.Checkpoint != nil {
+			for _, r := range c.Checkpoint.Results {
+				if err := c.Sink.Write(r); err != nil {
+					return err
+				}
+			}
+		}
 
-		return c.OutputResults(rs, cfg.Out)
+		ctx, stop := interruptContext()
+		defer stop()
+		rs, err := c.GenerateTraffic(ctx)
+		var aborted *iperf3.CycleError
+		if err != nil && ctx.Err() == nil && !errors.As(err, &aborted) {
+			return err
+		}
+
+		if cfg.Summary != "" {
+			err = c.OutputSummary(rs, cfg.Summary)
+		} else {
+			err = c.Sink.WriteTotals(rs)
+		}
+		if err != nil {
+			return err
+		}
+		if aborted != nil {
+			cmd.SilenceUsage = true
+			return aborted
+		}
+		if ctx.Err() == nil && c.Checkpoint != nil {
+			if err := c.Checkpoint.Remove(); err != nil {
+				return err
+			}
+		}
+		if err := interrupted(cmd, ctx); err != nil {
+			return err
+		}
+		return failed(cmd, cfg, rs)
 	},
 }
 
@@ -56,16 +157,44 @@ func init() {
 
 	flags := runCmd.Flags()
 	flags.String(option.Param, "", "path to the param file")
+	flags.String(option.Summary, "", "path to a file for the totals of the run instead of the end of the results")
+	addRunFlags(flags)
+	flags.Float64(option.MaxDuration, 0, "maximum runtime seconds of the plan, longer plans are refused (default unlimited)")
+	flags.String(option.Checkpoint, "", "path to the checkpoint file of the run (default the results path with a .checkpoint suffix)")
+	flags.Bool(option.Resume, false, "resume an interrupted run from its checkpoint")
+
+	_ = runCmd.MarkFlagRequired(option.Param)
+	_ = runCmd.MarkFlagRequired(option.DstAddr)
+}
+
+// checkpointPath returns the path of the checkpoint of the run, or an empty path if the results go to stdout
+// and no checkpoint path is given.
+func checkpointPath(cfg option.Config) string {
+	if cfg.Checkpoint != "" || cfg.Out == "" {
+		return cfg.Checkpoint
+	}
+	return cfg.Out + ".checkpoint"
+}
+
+// addRunFlags adds the flags of the iperf3 client.
+func addRunFlags(flags *pflag.FlagSet) {
 	flags.StringP(option.DstAddr, "a", "", "destination ip address")
+	flags.String(option.SrcAddr, "", "source address whose cycles of a plan of many sources are run")
 	flags.StringP(option.DstPort, "p", "", "destination port number")
+	flags.String(option.Ports, "", "pool of server ports for overlapping flows (e.g. 5201-5208)")
 	flags.Int64P(option.Mss, "m", 0, "TCP/SCTP maximum segment size")
 	flags.Bool(option.UDP, false, "Run iperf3 client with udp option")
 	flags.Bool(option.IPv6, false, "only ipv6")
 	flags.Int64(option.Flowlabel, -1, "ipv6 flow label")
 	flags.StringP(option.WindowSize, "w", "", "window size / socket buffer size")
-
-	_ = viper.BindPFlags(flags)
-
-	_ = runCmd.MarkFlagRequired(option.Param)
-	_ = runCmd.MarkFlagRequired(option.DstAddr)
+	flags.IntP(option.Parallel, "P", 1, "number of parallel client streams, among which the bitrate of every cycle is divided")
+	flags.StringP(option.TOS, "S", "", "IP type of service")
+	flags.BoolP(option.Reverse, "R", false, "run in reverse mode (server sends, client receives)")
+	flags.String(option.LagPolicy, iperf3.LagRun, "what to do with cycles which start late (run, skip, compress)")
+	flags.Float64(option.MaxLag, 0.5, "seconds a cycle may start late before --lag-policy applies")
+	flags.String(option.OnFailure, iperf3.FailureSkip, "what to do with cycles which iperf3 fails to run (abort, retry, skip)")
+	flags.Int(option.Retries, 3, "number of times --on-failure=retry runs a failed cycle again")
+	flags.Float64(option.RetryBackoff, 1, "seconds before the first retry of a failed cycle, doubling after every retry")
+	flags.Float64(option.ConnectTimeout, 0, "seconds iperf3 tries to connect to the server (default the timeout of iperf3)")
+	flags.Int(option.MaxFailures, 0, "number of failed cycles tolerated before tg exits with a failure (-1 for unlimited)")
 }
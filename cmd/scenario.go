@@ -0,0 +1,116 @@
+/*
+Copyright © 2021 Tomoki Sugiura <cheztomo513@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"github.com/chez-shanpu/traffic-generator/pkg/option"
+	"github.com/chez-shanpu/traffic-generator/pkg/scenario"
+	"github.com/spf13/cobra"
+)
+
+// scenarioCmd represents the scenario command
+var scenarioCmd = &cobra.Command{
+	Use:   "scenario",
+	Short: "Compose traffic phases",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+// scenarioRunCmd represents the scenario run command
+var scenarioRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Run the phases of a scenario file and output their results",
+	Long: `Run the phases of a scenario file and output their results.
+
+A scenario file is a YAML list of phases run one after another, such as warm-up, ramp, steady state
+and cool-down phases:
+
+  defaults:
+    send-dist: exponential:rate=0.5
+  phases:
+  - name: warmup
+    params: warmup.csv
+    transition:
+      pause: 10s
+  - name: ramp
+    settings: {cycle: 10, bitrate: 10M}
+    repeat: 3
+  - parallel:
+    - name: bulk
+      settings: {cycle: 50, bitrate: 100M, dst-port: 5201}
+    - name: voip
+      settings: {cycle: 50, workload: synth-voip, dst-port: 5202}
+
+Each phase runs a fixed params file, relative to the scenario file, or a plan generated from its
+settings, whose keys are the flags of tg init and tg run. Settings override the defaults of the
+scenario, which override the flags. Phases of a parallel group run concurrently and share the
+settings of the group, so give them different destination ports. Repeat runs a phase or a group
+again, generating a new plan each time, and the pause of its transition idles before the next phase.
+
+The results of every phase are written as one CSV whose Phase and Repeat columns tell the phase
+of each cycle, followed by the totals of every phase and of the scenario. On SIGINT or SIGTERM the
+results so far are written like tg run does.`,
+	PreRunE: bindFlags,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg := option.Config{}
+		cfg.Populate()
+
+		s, err := scenario.Load(cfg.Input)
+		if err != nil {
+			return err
+		}
+		stages, err := s.Expand()
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := interruptContext()
+		defer stop()
+		rs, ps, err := scenario.Execute(ctx, stages)
+		if err != nil && ctx.Err() == nil {
+			return err
+		}
+
+		if err := scenario.OutputResults(rs, ps, cfg.Out); err != nil {
+			return err
+		}
+		if err := interrupted(cmd, ctx); err != nil {
+			return err
+		}
+		return failed(cmd, cfg, rs)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(scenarioCmd)
+	scenarioCmd.AddCommand(scenarioRunCmd)
+
+	flags := scenarioRunCmd.Flags()
+	flags.StringP(option.Input, "i", "", "path to the scenario file")
+	addPlannerFlags(flags)
+	flags.Int(option.Flows, 1, "number of concurrent flows of the generated phases")
+	addRunFlags(flags)
+
+	_ = scenarioRunCmd.MarkFlagRequired(option.Input)
+}
@@ -26,6 +26,7 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 
 	"github.com/chez-shanpu/traffic-generator/pkg/iperf3"
@@ -38,11 +39,23 @@ import (
 var serverCmd = &cobra.Command{
 	Use:   "server",
 	Short: "Run server which handle only one client connection",
+	Long: `Run server which handle only one client connection.
+
+--ports runs a server on each of the given ports (e.g. 5201-5204) to receive the concurrent
+flows of a multi-flow plan, which tg run sends to consecutive ports from --dst-port.`,
+	PreRunE: bindFlags,
 	Run: func(cmd *cobra.Command, args []string) {
 		cfg := option.Config{}
 		cfg.Populate()
-		s := iperf3.NewServer()
-		errCh := make(chan error, 1)
+		ss := []*iperf3.Server{iperf3.NewServer()}
+		if cfg.Ports != "" {
+			var err error
+			if ss, err = iperf3.NewServers(cfg.Ports); err != nil {
+				fmt.Printf("[ERROR]: %v", err)
+				return
+			}
+		}
+		errCh := make(chan error, len(ss))
 
 		sigs := make(chan os.Signal, 1)
 		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
@@ -50,20 +63,28 @@ var serverCmd = &cobra.Command{
 			signal.Stop(sigs)
 		}()
 
+		var mu sync.Mutex
 		var ress traffic.Results
-		go func() {
-			for {
-				res, err := s.Run()
-				if err != nil {
-					errCh <- err
+		for _, s := range ss {
+			go func(s *iperf3.Server) {
+				for {
+					res, err := s.Run()
+					if err != nil {
+						errCh <- err
+						return
+					}
+					mu.Lock()
+					ress = append(ress, res)
+					mu.Unlock()
 				}
-				ress = append(ress, res)
-			}
-		}()
+			}(s)
+		}
 
 		select {
 		case <-sigs:
-			if err := s.OutputResult(ress, cfg.Out); err != nil {
+			mu.Lock()
+			defer mu.Unlock()
+			if err := ss[0].OutputResult(ress, cfg.Out); err != nil {
 				fmt.Printf("[ERROR]: %v", err)
 			}
 		case err := <-errCh:
@@ -74,4 +95,6 @@ var serverCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(serverCmd)
+
+	serverCmd.Flags().String(option.Ports, "", "comma separated ports and port ranges to listen on (e.g. 5201-5204)")
 }
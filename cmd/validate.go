@@ -0,0 +1,85 @@
+/*
+Copyright © 2021 Tomoki Sugiura <cheztomo513@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/chez-shanpu/traffic-generator/pkg/iperf3"
+	"github.com/chez-shanpu/traffic-generator/pkg/option"
+	"github.com/chez-shanpu/traffic-generator/pkg/traffic"
+	"github.com/spf13/cobra"
+)
+
+// validateCmd represents the validate command
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check a params file before running it",
+	Long: `Check a params file before running it.
+
+Every cycle is checked for values which iperf3 would reject or misinterpret: unparsable bitrates
+and integers, negative durations, a send duration of 0 which iperf3 takes as its default of 10
+seconds, ports, TOS, flow labels, window sizes and numbers of parallel streams out of range. Start
+offsets must not go back in time within a flow, Protocol must be tcp or udp, and Mss applies to
+tcp cycles only, taking --udp and --mss as the defaults of cycles which do not override them. Flow
+labels apply to runs with --ipv6 only, taking --flowlabel as the default. With --max-duration the
+runtime of the plan must not exceed it.
+
+All problems of CSV, JSON and YAML plans are reported with the number of their cycle, as in the
+Cycle column of CSV files.
+tg run validates the plan the same way before running it.`,
+	SilenceUsage: true,
+	PreRunE:      bindFlags,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg := option.Config{}
+		cfg.Populate()
+
+		p, err := traffic.LoadPlan(cfg.Param)
+		if err != nil {
+			return err
+		}
+		if err := iperf3.ValidateParams(cfg, p.Cycles); err != nil {
+			return fmt.Errorf("%s: %w", cfg.Param, err)
+		}
+
+		runtime := time.Duration(p.Cycles.Runtime()) * time.Millisecond
+		fmt.Printf("%s: %d cycles of %d flows, runtime %s, %d bytes\n",
+			cfg.Param, len(p.Cycles), len(p.Cycles.ByFlow()), runtime, p.Cycles.TotalBytes())
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+
+	flags := validateCmd.Flags()
+	flags.String(option.Param, "", "path to the param file")
+	flags.Int64P(option.Mss, "m", 0, "TCP/SCTP maximum segment size of the run")
+	flags.Bool(option.UDP, false, "validate for a run with the udp option")
+	flags.Bool(option.IPv6, false, "validate for a run with the ipv6 option")
+	flags.Int64(option.Flowlabel, 0, "IPv6 flow label of the run")
+	flags.Float64(option.MaxDuration, 0, "maximum runtime seconds of the plan (default unlimited)")
+
+	_ = validateCmd.MarkFlagRequired(option.Param)
+}
@@ -3,9 +3,11 @@ module github.com/chez-shanpu/traffic-generator
 go 1.16
 
 require (
-	github.com/gocarina/gocsv v0.0.0-20210516172204-ca9e8a8ddea8
+	github.com/spf13/cast v1.3.1
 	github.com/spf13/cobra v1.1.3
+	github.com/spf13/pflag v1.0.5
 	github.com/spf13/viper v1.8.0
 	golang.org/x/exp v0.0.0-20210615023648-acb5c1269671
 	gonum.org/v1/gonum v0.9.1
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,201 @@
+package iperf3
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/chez-shanpu/traffic-generator/pkg/traffic"
+)
+
+// Checkpoint records the progress of a run in a file after every cycle, so that a run which died can be
+// resumed from the next cycle instead of from the start of the plan.
+//
+// The file is a log of JSON lines: a header with the hash of the plan followed by a record of every completed
+// cycle, which is appended and synced to disk as soon as the cycle ends. A record cut short by a crash is
+// dropped when the checkpoint is loaded.
+type Checkpoint struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+	done map[int]bool
+	// PlanHash identifies the plan, so that a run is not resumed with another plan.
+	PlanHash string
+	// LastCycle is the last cycle up to which every cycle has completed, or -1. Cycles of other flows after
+	// it may have completed too when flows run concurrently.
+	LastCycle int
+	Results   traffic.Results
+}
+
+type checkpointHeader struct {
+	PlanHash string `json:"plan_hash"`
+}
+
+type checkpointRecord struct {
+	LastCycle int             `json:"last_cycle"`
+	Result    *traffic.Result `json:"result"`
+}
+
+// NewCheckpoint creates an empty checkpoint of the plan ps in path, replacing any checkpoint there.
+func NewCheckpoint(path string, ps []*Param) (*Checkpoint, error) {
+	cp := &Checkpoint{
+		path:      path,
+		done:      map[int]bool{},
+		PlanHash:  traffic.Params(ps).Hash(),
+		LastCycle: -1,
+	}
+	b, err := json.Marshal(checkpointHeader{PlanHash: cp.PlanHash})
+	if err != nil {
+		return nil, err
+	}
+
+	// the header is written to a temporary file which replaces the checkpoint, so that a crash leaves either
+	// the previous checkpoint or the new one
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	f, err := ioutil.TempFile(dir, name+".*")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(append(b, '\n')); err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err == nil {
+		err = syncDir(dir)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	cp.f = f
+	return cp, nil
+}
+
+// LoadCheckpoint reads the checkpoint in path, checks that it is a checkpoint of the plan ps and opens it to
+// record the next cycles.
+func LoadCheckpoint(path string, ps []*Param) (*Checkpoint, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var h checkpointHeader
+	end := bytes.IndexByte(b, '\n')
+	if end < 0 || json.Unmarshal(b[:end], &h) != nil {
+		return nil, fmt.Errorf("%s is not a checkpoint", path)
+	}
+	if h.PlanHash != traffic.Params(ps).Hash() {
+		return nil, fmt.Errorf("%s is a checkpoint of another plan", path)
+	}
+
+	cp := &Checkpoint{
+		path:      path,
+		done:      map[int]bool{},
+		PlanHash:  h.PlanHash,
+		LastCycle: -1,
+	}
+	valid := end + 1
+	for n := 2; valid < len(b); n++ {
+		end := bytes.IndexByte(b[valid:], '\n')
+		if end < 0 {
+			// the last record was cut short
+			break
+		}
+		var rec checkpointRecord
+		if err := json.Unmarshal(b[valid:valid+end], &rec); err != nil {
+			return nil, fmt.Errorf("%s: line %d: %w", path, n, err)
+		}
+		r := rec.Result
+		if r == nil || r.Cycle < 0 || r.Cycle >= len(ps) {
+			return nil, fmt.Errorf("%s: line %d: the result is not of a cycle of the plan", path, n)
+		}
+		cp.add(r)
+		valid += end + 1
+	}
+
+	if cp.f, err = os.OpenFile(path, os.O_WRONLY, 0); err != nil {
+		return nil, err
+	}
+	if err := cp.f.Truncate(int64(valid)); err != nil {
+		cp.f.Close()
+		return nil, err
+	}
+	if _, err := cp.f.Seek(int64(valid), 0); err != nil {
+		cp.f.Close()
+		return nil, err
+	}
+	return cp, nil
+}
+
+// Completed returns the results of the plan ps recorded so far, indexed by cycle, with nil for the cycles
+// which have not completed.
+func (cp *Checkpoint) Completed(ps []*Param) traffic.Results {
+	rs := make(traffic.Results, len(ps))
+	for _, r := range cp.Results {
+		rs[r.Cycle] = r
+	}
+	return rs
+}
+
+// Record appends the result of a completed cycle to the checkpoint and syncs it to disk. It is safe to call
+// from the goroutines of every flow.
+func (cp *Checkpoint) Record(r *traffic.Result) error {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	cp.add(r)
+	b, err := json.Marshal(checkpointRecord{LastCycle: cp.LastCycle, Result: r})
+	if err != nil {
+		return err
+	}
+	if _, err := cp.f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	return cp.f.Sync()
+}
+
+func (cp *Checkpoint) add(r *traffic.Result) {
+	cp.Results = append(cp.Results, r)
+	cp.done[r.Cycle] = true
+	for cp.done[cp.LastCycle+1] {
+		cp.LastCycle++
+	}
+}
+
+// Close closes the checkpoint file, leaving it for a resumed run.
+func (cp *Checkpoint) Close() error {
+	return cp.f.Close()
+}
+
+// Remove closes and removes the checkpoint file once the run has completed.
+func (cp *Checkpoint) Remove() error {
+	cp.f.Close()
+	err := os.Remove(cp.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// syncDir syncs a directory, so that a file renamed into it survives a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
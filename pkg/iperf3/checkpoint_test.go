@@ -0,0 +1,108 @@
+package iperf3
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/chez-shanpu/traffic-generator/pkg/traffic"
+)
+
+func checkpointPlan() []*Param {
+	var ps []*Param
+	for i := 0; i < 4; i++ {
+		ps = append(ps, &Param{Bitrate: 1e6, SendSeconds: traffic.Second(i + 1), WaitMilliSeconds: 1000})
+	}
+	return ps
+}
+
+func recordCycles(t *testing.T, cp *Checkpoint, cycles ...int) {
+	t.Helper()
+	for _, i := range cycles {
+		if err := cp.Record(&traffic.Result{Cycle: i, SendByte: int64(1000 * (i + 1)), Status: traffic.StatusOK}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func completedCycles(rs traffic.Results) []int {
+	var cs []int
+	for _, r := range rs {
+		if r != nil {
+			cs = append(cs, r.Cycle)
+		}
+	}
+	return cs
+}
+
+func TestCheckpointResumeTruncated(t *testing.T) {
+	ps := checkpointPlan()
+	path := filepath.Join(t.TempDir(), "run.checkpoint")
+
+	cp, err := NewCheckpoint(path, ps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordCycles(t, cp, 0, 1, 2)
+	if err := cp.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a crash while the record of cycle 2 was written leaves part of it
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, b[:len(b)-10], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cp, err = LoadCheckpoint(path, ps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.LastCycle != 1 {
+		t.Errorf("last cycle %d, expected 1", cp.LastCycle)
+	}
+	if got := completedCycles(cp.Completed(ps)); !reflect.DeepEqual(got, []int{0, 1}) {
+		t.Errorf("completed cycles %v, expected [0 1]", got)
+	}
+
+	// the resumed run records the cycles after the last complete record
+	recordCycles(t, cp, 2, 3)
+	if err := cp.Close(); err != nil {
+		t.Fatal(err)
+	}
+	cp, err = LoadCheckpoint(path, ps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cp.Close()
+	if cp.LastCycle != 3 {
+		t.Errorf("last cycle %d after resuming, expected 3", cp.LastCycle)
+	}
+	rs := cp.Completed(ps)
+	if got := completedCycles(rs); !reflect.DeepEqual(got, []int{0, 1, 2, 3}) {
+		t.Errorf("completed cycles %v after resuming, expected [0 1 2 3]", got)
+	}
+	if rs[2].SendByte != 3000 {
+		t.Errorf("send bytes %d of cycle 2, expected 3000", rs[2].SendByte)
+	}
+}
+
+func TestCheckpointOfAnotherPlan(t *testing.T) {
+	ps := checkpointPlan()
+	path := filepath.Join(t.TempDir(), "run.checkpoint")
+	cp, err := NewCheckpoint(path, ps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordCycles(t, cp, 0)
+	cp.Close()
+
+	ps[3].SendSeconds++
+	if _, err := LoadCheckpoint(path, ps); err == nil {
+		t.Error("a checkpoint of another plan is loaded")
+	}
+}
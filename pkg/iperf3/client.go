@@ -23,39 +23,64 @@ THE SOFTWARE.
 package iperf3
 
 import (
-	"encoding/csv"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
+	"net"
 	"os"
 	"os/exec"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/chez-shanpu/traffic-generator/pkg/file"
-
 	"github.com/chez-shanpu/traffic-generator/pkg/option"
 
 	"github.com/chez-shanpu/traffic-generator/pkg/traffic"
-
-	"github.com/gocarina/gocsv"
 )
 
-type Param struct {
-	Bitrate          traffic.Bitrate     `csv:"Bitrate"`
-	SendSeconds      traffic.Second      `csv:"SendSeconds"`
-	WaitMilliSeconds traffic.MilliSecond `csv:"WaitMilliSeconds"`
-}
+// Param is a cycle of the params file.
+type Param = traffic.Param
+
+// defaultPort is the port of iperf3 servers. Flows of a multi-flow plan without a destination port
+// are sent to consecutive ports from the destination port of the client, or from defaultPort.
+const defaultPort = 5201
 
 type Client struct {
-	Params             []*Param
-	DstAddr            string
-	DstPort            string
+	Params  []*Param
+	DstAddr string
+	DstPort string
+	// Ports is a pool of server ports. Cycles without a destination port in the plan take a free port of the
+	// pool, so that overlapping flows are sent to different servers.
+	Ports              []string
 	MaximumSegmentSize int64
 	UdpFlag            bool
 	IPv6Flag           bool
 	Flowlabel          int64
 	WindowSize         string
+	Parallel           int
+	TOS                string
+	Reverse            bool
+	// LagPolicy is what the client does with a cycle which starts later than MaxLag after its planned start.
+	LagPolicy string
+	MaxLag    time.Duration
+	// FailurePolicy is what the client does with a cycle which iperf3 failed to run. Retried cycles are run up
+	// to Retries more times, waiting RetryBackoff before the first retry and twice as long before every next.
+	FailurePolicy string
+	Retries       int
+	RetryBackoff  time.Duration
+	// ConnectTimeout is how long iperf3 tries to connect to the server, or 0 for the default of iperf3. A cycle
+	// which runs longer than its send duration, the connect timeout and runGrace is stopped with a timeout.
+	ConnectTimeout time.Duration
+	// Sink streams the result of every cycle as soon as it ends.
+	Sink *ResultWriter
+	// Checkpoint records every completed cycle. Cycles which it has results of are not run again.
+	Checkpoint *Checkpoint
 }
 
 func NewIperfClientFromParamsFile(cfg option.Config) (*Client, error) {
@@ -63,8 +88,53 @@ func NewIperfClientFromParamsFile(cfg option.Config) (*Client, error) {
 	if err != nil {
 		return nil, err
 	}
+	return NewIperfClientFromParams(cfg, ps)
+}
+
+// NewIperfClientFromParams returns a client running the cycles of the source selected by cfg
+// with the server ports of cfg.
+func NewIperfClientFromParams(cfg option.Config, ps []*Param) (*Client, error) {
+	if err := ValidateParams(cfg, ps); err != nil {
+		return nil, err
+	}
+	ps, err := selectSource(ps, cfg.SrcAddr)
+	if err != nil {
+		return nil, err
+	}
 
-	return NewIperfClient(cfg, ps), nil
+	c := NewIperfClient(cfg, ps)
+	switch c.LagPolicy {
+	case "", LagRun, LagSkip, LagCompress:
+	default:
+		return nil, fmt.Errorf("unknown lag policy %q (available: %s, %s, %s)", c.LagPolicy, LagRun, LagSkip, LagCompress)
+	}
+	switch c.FailurePolicy {
+	case "", FailureAbort, FailureRetry, FailureSkip:
+	default:
+		return nil, fmt.Errorf("unknown failure policy %q (available: %s, %s, %s)", c.FailurePolicy, FailureAbort, FailureRetry, FailureSkip)
+	}
+	if cfg.Ports != "" {
+		if c.Ports, err = ParsePorts(cfg.Ports); err != nil {
+			return nil, err
+		}
+	} else if err := c.checkFlowPorts(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// checkFlowPorts checks that the flows of a multi-flow plan run without a pool of ports have server ports. Plans
+// of many flows, such as the flows of the arrival model, may number their flows beyond the last port.
+func (c Client) checkFlowPorts() error {
+	for _, p := range c.Params {
+		if p.DstPort != "" {
+			continue
+		}
+		if n, err := strconv.Atoi(c.dstPort(p)); err == nil && n > 65535 {
+			return fmt.Errorf("flow %d would be sent to port %d, give a pool of server ports with --%s", p.Flow, n, option.Ports)
+		}
+	}
+	return nil
 }
 
 func NewIperfClient(cfg option.Config, params []*Param) *Client {
@@ -76,73 +146,318 @@ func NewIperfClient(cfg option.Config, params []*Param) *Client {
 		IPv6Flag:           cfg.IPv6,
 		Flowlabel:          cfg.Flowlabel,
 		WindowSize:         cfg.WindowSize,
+		Parallel:           cfg.Parallel,
+		TOS:                cfg.TOS,
+		Reverse:            cfg.Reverse,
+		LagPolicy:          cfg.LagPolicy,
+		MaxLag:             time.Duration(cfg.MaxLag * float64(time.Second)),
+		FailurePolicy:      cfg.OnFailure,
+		Retries:            cfg.Retries,
+		RetryBackoff:       time.Duration(cfg.RetryBackoff * float64(time.Second)),
+		ConnectTimeout:     time.Duration(cfg.ConnectTimeout * float64(time.Second)),
 		Params:             params,
 	}
 }
 
+// ValidateParams checks the cycles of a plan against the options of the run given by cfg.
+func ValidateParams(cfg option.Config, ps []*Param) error {
+	return traffic.Params(ps).Validate(traffic.RunOptions{
+		UDP:         cfg.UDP,
+		Mss:         cfg.Mss,
+		IPv6:        cfg.IPv6,
+		Flowlabel:   cfg.Flowlabel,
+		MaxDuration: traffic.MilliSecond(cfg.MaxDuration * 1000),
+	})
+}
+
 func parseParamsFile(paramFilePath string) ([]*Param, error) {
-	f, err := os.Open(paramFilePath)
+	p, err := traffic.LoadPlan(paramFilePath)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
+	return p.Cycles, nil
+}
 
-	var params []*Param
-	err = gocsv.UnmarshalFile(f, &params)
-	return params, err
+// selectSource returns the cycles of the source src of a plan of many sources.
+// A plan of a single source is run as it is.
+func selectSource(ps []*Param, src string) ([]*Param, error) {
+	sources := map[string]bool{}
+	for _, p := range ps {
+		if p.SrcAddr != "" {
+			sources[p.SrcAddr] = true
+		}
+	}
+	if src == "" {
+		if len(sources) > 1 {
+			return nil, fmt.Errorf("the plan has cycles of %d sources, select one with --%s", len(sources), option.SrcAddr)
+		}
+		return ps, nil
+	}
+	if !sources[src] {
+		return nil, fmt.Errorf("the plan has no cycles of source %s", src)
+	}
+
+	var res []*Param
+	for _, p := range ps {
+		if p.SrcAddr == src {
+			res = append(res, p)
+		}
+	}
+	return res, nil
 }
 
-func (c Client) GenerateTraffic() (traffic.Results, error) {
-	var rs traffic.Results
+// GenerateTraffic runs the cycles of the plan. Flows run concurrently, and every cycle starts at its planned
+// time on the timeline of the plan, its start offset or the end of the wait after the previous cycle of its
+// flow, whichever is later. As the timeline is absolute, the overhead of starting and stopping iperf3 is
+// absorbed by the following waits instead of delaying the rest of the plan. Cycles which start later than
+// MaxLag after their planned time are handled by the LagPolicy.
+//
+// When ctx is done the running iperf3 processes are interrupted and no more cycles start. The results of the
+// cycles run so far are returned with ctx.Err(), the interrupted cycles with the interrupted status and the
+// cycles which did not start as nil.
+//
+// With a Checkpoint the result of every completed cycle is recorded in it, and the cycles it already has
+// results of are not run again. The rest of the plan then starts right away, keeping the timeline of the plan
+// from the earliest cycle left.
+//
+// When a cycle fails and the FailurePolicy is to abort, the other flows are interrupted like on ctx and the
+// results so far are returned with a *CycleError.
+func (c Client) GenerateTraffic(ctx context.Context) (traffic.Results, error) {
+	rs := make(traffic.Results, len(c.Params))
+	resumed := c.Checkpoint != nil && len(c.Checkpoint.Results) > 0
+	if resumed {
+		rs = c.Checkpoint.Completed(c.Params)
+	}
+	flows := c.flowCycles()
+	errs := make([]error, len(flows))
+	var pool chan string
+	if len(c.Ports) > 0 {
+		pool = make(chan string, len(c.Ports))
+		for _, p := range c.Ports {
+			pool <- p
+		}
+	}
+	planned := traffic.Params(c.Params).Starts()
+	start := time.Now()
+	if origin, ok := firstPending(planned, rs); resumed && ok {
+		start = start.Add(-time.Duration(origin) * time.Millisecond)
+	}
 
-	for i, p := range c.Params {
-		fmt.Printf("Run %d: Bitrate %s, SendSeconds %d\n", i, p.Bitrate, p.SendSeconds)
-		r, err := c.execIperf3(c.makeIperf3Args(p))
+	run, abort := context.WithCancel(ctx)
+	defer abort()
+	var wg sync.WaitGroup
+	for i, cycles := range flows {
+		wg.Add(1)
+		go func(i int, cycles []int) {
+			defer wg.Done()
+			errs[i] = c.runFlow(run, start, planned, cycles, rs, pool)
+			var ce *CycleError
+			if errors.As(errs[i], &ce) {
+				abort()
+			}
+		}(i, cycles)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return rs, err
+	}
+	for _, err := range errs {
+		var ce *CycleError
+		if errors.As(err, &ce) {
+			return rs, err
+		}
+	}
+	for _, err := range errs {
 		if err != nil {
 			return nil, err
 		}
-		rs = append(rs, r)
-		fmt.Printf("sleep %d msec\n", p.WaitMilliSeconds)
-		time.Sleep(time.Duration(p.WaitMilliSeconds) * time.Millisecond)
 	}
 	return rs, nil
 }
 
-func (c Client) OutputResults(rs traffic.Results, out string) error {
-	f, err := file.Create(out)
-	if err != nil {
-		return err
+func (c Client) runFlow(ctx context.Context, start time.Time, planned []traffic.MilliSecond, cycles []int, rs traffic.Results, pool chan string) error {
+	for _, i := range cycles {
+		if rs[i] != nil {
+			continue
+		}
+		p := c.Params[i]
+		at := start.Add(time.Duration(planned[i]) * time.Millisecond)
+		if d := time.Until(at); d > 0 {
+			fmt.Printf("Flow %d: sleep %d msec\n", p.Flow, d.Milliseconds())
+			if err := sleep(ctx, d); err != nil {
+				return err
+			}
+		}
+
+		lag := time.Since(at)
+		q, ok := c.catchUp(p, lag)
+		if !ok {
+			fmt.Printf("Run %d: Flow %d, late by %d msec, skipped\n", i, p.Flow, lag.Milliseconds())
+			rs[i] = &traffic.Result{Cycle: i, Flow: p.Flow, Status: traffic.StatusSkipped}
+		} else {
+			port := c.dstPort(q)
+			if q.DstPort == "" && pool != nil {
+				select {
+				case port = <-pool:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			fmt.Printf("Run %d: Flow %d, Bitrate %s, SendSeconds %d\n", i, q.Flow, q.Bitrate, q.SendSeconds)
+			launched := time.Since(start)
+			r, err := c.runCycle(ctx, i, q, port)
+			if q.DstPort == "" && pool != nil {
+				pool <- port
+			}
+			if err != nil {
+				return err
+			}
+			r.Cycle = i
+			r.Flow = p.Flow
+			r.StartSecond = launched.Seconds()
+			rs[i] = r
+		}
+		rs[i].PlannedStartSecond = (time.Duration(planned[i]) * time.Millisecond).Seconds()
+		if c.Sink != nil {
+			if err := c.Sink.Write(rs[i]); err != nil {
+				return err
+			}
+		}
+		if c.Checkpoint != nil && rs[i].Status != traffic.StatusInterrupted {
+			if err := c.Checkpoint.Record(rs[i]); err != nil {
+				return err
+			}
+		}
+		if rs[i].Failed() && c.FailurePolicy == FailureAbort {
+			return &CycleError{Cycle: i, Status: rs[i].Status, Message: rs[i].Error}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 	}
-	return c.OutputResultsCSV(rs, f)
+	return nil
 }
 
-func (c Client) OutputResultsCSV(rs traffic.Results, f *os.File) error {
-	w := csv.NewWriter(f)
-	defer w.Flush()
+// runCycle runs iperf3 for the cycle i, and runs it again after failures if the failure policy is to retry.
+func (c Client) runCycle(ctx context.Context, i int, p *Param, port string) (*traffic.Result, error) {
+	backoff := c.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		r, err := c.execIperf3(ctx, c.makeIperf3Args(p, port), c.runTimeout(p))
+		if err != nil || !r.Failed() || c.FailurePolicy != FailureRetry || attempt >= c.Retries {
+			return r, err
+		}
+		fmt.Printf("Run %d: %s, retry %d/%d in %d msec\n", i, r.Status, attempt+1, c.Retries, backoff.Milliseconds())
+		if err := sleep(ctx, backoff); err != nil {
+			// the retry was interrupted, so that the cycle is run again when the run is resumed
+			r.Status = traffic.StatusInterrupted
+			return r, nil
+		}
+		backoff *= 2
+	}
+}
 
-	csvHead := []string{"Cycle", "SendByte", "Bitrate", "SendSecond", "WaitMilliSecond"}
-	if err := w.Write(csvHead); err != nil {
-		return err
+// runTimeout returns how long iperf3 may run the cycle p before it is stopped. Cycles which send a flow size
+// may take twice their expected send duration.
+func (c Client) runTimeout(p *Param) time.Duration {
+	send := time.Duration(p.SendSeconds) * time.Second
+	if p.FlowBytes > 0 {
+		send *= 2
 	}
+	return send + c.ConnectTimeout + runGrace
+}
 
-	for i, r := range rs {
-		var line []string
-		line = append(line, strconv.Itoa(i))
-		line = append(line, strconv.FormatInt(r.SendByte, 10))
-		line = append(line, string(c.Params[i].Bitrate))
-		line = append(line, strconv.FormatFloat(r.SendSecond, 'f', -1, 64))
-		line = append(line, strconv.FormatInt(int64(c.Params[i].WaitMilliSeconds), 10))
-		if err := w.Write(line); err != nil {
-			return err
+// CycleError is the error of a run aborted by the failure of a cycle.
+type CycleError struct {
+	Cycle   int
+	Status  string
+	Message string
+}
+
+func (e *CycleError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("cycle %d failed: %s", e.Cycle, e.Status)
+	}
+	return fmt.Sprintf("cycle %d failed: %s: %s", e.Cycle, e.Status, e.Message)
+}
+
+// firstPending returns the earliest planned start of the cycles which have no results, and false if every
+// cycle has results.
+func firstPending(planned []traffic.MilliSecond, rs traffic.Results) (traffic.MilliSecond, bool) {
+	var first traffic.MilliSecond
+	ok := false
+	for i, s := range planned {
+		if rs[i] == nil && (!ok || s < first) {
+			first, ok = s, true
+		}
+	}
+	return first, ok
+}
+
+// sleep waits for d, or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// catchUp returns the cycle to run for a cycle which starts lag after its planned start, and false if the
+// cycle is skipped. Compressed cycles are shortened by the lag, or send their flow at a higher bitrate, so
+// that they end when they were planned to end. Cycles which cannot be shortened any more are skipped.
+func (c Client) catchUp(p *Param, lag time.Duration) (*Param, bool) {
+	if lag <= c.MaxLag {
+		return p, true
+	}
+	switch c.LagPolicy {
+	case LagSkip:
+		return nil, false
+	case LagCompress:
+		q := *p
+		left := time.Duration(p.SendSeconds)*time.Second - lag
+		if left < time.Second {
+			return nil, false
+		}
+		if q.FlowBytes > 0 {
+			q.Bitrate = traffic.Bitrate(math.Ceil(float64(q.FlowBytes) * 8 / left.Seconds()))
+		} else {
+			q.SendSeconds = traffic.Second(left / time.Second)
+		}
+		return &q, true
+	}
+	return p, true
+}
+
+// flowCycles returns the indices of the cycles of each flow, ordered by flow identifier.
+func (c Client) flowCycles() [][]int {
+	cycles := map[int][]int{}
+	var flows []int
+	for i, p := range c.Params {
+		if _, ok := cycles[p.Flow]; !ok {
+			flows = append(flows, p.Flow)
+		}
+		cycles[p.Flow] = append(cycles[p.Flow], i)
+	}
+	sort.Ints(flows)
+
+	res := make([][]int, len(flows))
+	for i, f := range flows {
+		res[i] = cycles[f]
+	}
+	return res
+}
+
+func (c Client) multiFlow() bool {
+	for _, p := range c.Params {
+		if p.Flow != c.Params[0].Flow {
+			return true
 		}
 	}
-	var line []string
-	line = append(line, "Total")
-	line = append(line, strconv.FormatInt(rs.TotalSendBytes(), 10))
-	line = append(line, "-")
-	line = append(line, strconv.FormatInt(int64(c.TotalSendSeconds()), 10))
-	line = append(line, strconv.FormatFloat(float64(c.TotalWaitMilliSeconds()), 'f', -1, 64))
-	return w.Write(line)
+	return false
 }
 
 func (c Client) TotalSendSeconds() traffic.Second {
@@ -161,72 +476,273 @@ func (c Client) TotalWaitMilliSeconds() traffic.MilliSecond {
 	return res
 }
 
-func (c Client) makeIperf3Args(p *Param) []string {
+func (c Client) makeIperf3Args(p *Param, port string) []string {
 	args := []string{
 		"-c",
-		c.DstAddr,
-		"-t", strconv.FormatInt(int64(p.SendSeconds), 10),
-		"-b", string(p.Bitrate),
-		"-J",
+		c.dstAddr(p),
 	}
-	if c.DstPort != "" {
+	if p.FlowBytes > 0 {
+		args = append(args, "-n", strconv.FormatInt(p.FlowBytes, 10))
+	} else {
+		args = append(args, "-t", strconv.FormatInt(int64(p.SendSeconds), 10))
+	}
+	// iperf3 applies the bitrate to every stream
+	parallel := c.Parallel
+	if p.Parallel != 0 {
+		parallel = p.Parallel
+	}
+	bitrate := p.Bitrate
+	if parallel > 1 {
+		bitrate = traffic.Bitrate(math.Round(float64(bitrate) / float64(parallel)))
+	}
+	args = append(args,
+		"-b", bitrate.String(),
+		"-J",
+	)
+	if port != "" {
 		args = append(args, "-p")
-		args = append(args, c.DstPort)
+		args = append(args, port)
+	}
+	mss := c.MaximumSegmentSize
+	if p.Mss != nil {
+		mss = *p.Mss
+	}
+	if c.ConnectTimeout > 0 {
+		args = append(args, "--connect-timeout")
+		args = append(args, strconv.FormatInt(c.ConnectTimeout.Milliseconds(), 10))
 	}
-	if c.MaximumSegmentSize != 0 {
+	if mss != 0 {
 		args = append(args, "-M")
-		args = append(args, strconv.FormatInt(c.MaximumSegmentSize, 10))
+		args = append(args, strconv.FormatInt(mss, 10))
 	}
-	if c.UdpFlag {
+	udp := c.UdpFlag
+	if p.Protocol != "" {
+		udp = strings.EqualFold(p.Protocol, "udp")
+	}
+	if udp {
 		args = append(args, "-u")
 	}
 	if c.IPv6Flag {
 		args = append(args, "-6")
 	}
-	if c.Flowlabel > 0 {
+	flowlabel := c.Flowlabel
+	if p.Flowlabel != nil {
+		flowlabel = *p.Flowlabel
+	}
+	if flowlabel > 0 {
 		args = append(args, "-L")
-		args = append(args, strconv.FormatInt(c.Flowlabel, 10))
+		args = append(args, strconv.FormatInt(flowlabel, 10))
 	}
-	if c.WindowSize != "" {
+	window := c.WindowSize
+	if p.Window != "" {
+		window = p.Window
+	}
+	if window != "" {
 		args = append(args, "-w")
-		args = append(args, c.WindowSize)
+		args = append(args, window)
+	}
+	if parallel > 1 {
+		args = append(args, "-P")
+		args = append(args, strconv.Itoa(parallel))
+	}
+	tos := c.TOS
+	if p.TOS != "" {
+		tos = p.TOS
+	}
+	if tos != "" {
+		args = append(args, "-S")
+		args = append(args, tos)
+	}
+	reverse := c.Reverse
+	if p.Reverse != nil {
+		reverse = *p.Reverse
+	}
+	if reverse {
+		args = append(args, "-R")
 	}
 	return args
 }
 
-func (c *Client) execIperf3(args []string) (res *traffic.Result, err error) {
-	out, err := exec.Command(iperf3, args...).CombinedOutput()
-	if err != nil {
-		fmt.Printf("[ERROR] Exec command: %s %s, output: %s, %s\n", iperf3, args, out, err)
-		return &traffic.Result{
-			SendByte:   0,
-			SendSecond: 0,
-		}, nil
+// Servers returns the iperf3 servers which the cycles of the client may be sent to, as host:port. Cycles
+// without a destination port may be sent to any port of the pool.
+func (c Client) Servers() []string {
+	seen := map[string]bool{}
+	var servers []string
+	for _, p := range c.Params {
+		ports := []string{c.dstPort(p)}
+		if p.DstPort == "" && len(c.Ports) > 0 {
+			ports = c.Ports
+		}
+		for _, port := range ports {
+			if port == "" {
+				port = strconv.Itoa(defaultPort)
+			}
+			s := net.JoinHostPort(c.dstAddr(p), port)
+			if !seen[s] {
+				seen[s] = true
+				servers = append(servers, s)
+			}
+		}
+	}
+	sort.Strings(servers)
+	return servers
+}
+
+func (c Client) dstAddr(p *Param) string {
+	if p.DstAddr != "" {
+		return p.DstAddr
+	}
+	return c.DstAddr
+}
+
+// dstPort returns the destination port of the cycle. Flows of a multi-flow plan without a port are
+// sent to their own server port.
+func (c Client) dstPort(p *Param) string {
+	if p.DstPort != "" {
+		return p.DstPort
+	}
+	if !c.multiFlow() {
+		return c.DstPort
+	}
+
+	base := defaultPort
+	if c.DstPort != "" {
+		n, err := strconv.Atoi(c.DstPort)
+		if err != nil {
+			// let iperf3 report the invalid port
+			return c.DstPort
+		}
+		base = n
+	}
+	return strconv.Itoa(base + p.Flow)
+}
+
+// execIperf3 runs iperf3 until it ends, or for timeout at most. When ctx is done or the timeout expires
+// iperf3 is interrupted, so that it stops the test and reports what it sent so far, and killed if it does
+// not exit within interruptGrace. Failures of iperf3 are not errors but results with the status of the
+// failure and the error iperf3 reported.
+func (c *Client) execIperf3(ctx context.Context, args []string, timeout time.Duration) (*traffic.Result, error) {
+	deadline, stop := context.WithTimeout(ctx, timeout)
+	defer stop()
+	kill, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cmd := exec.CommandContext(kill, iperf3, args...)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		fmt.Printf("[ERROR] Exec command: %s %s, %s\n", iperf3, args, err)
+		return &traffic.Result{Status: traffic.StatusError, Error: err.Error()}, nil
 	}
+	exited := make(chan struct{})
+	go func() {
+		select {
+		case <-deadline.Done():
+			_ = cmd.Process.Signal(os.Interrupt)
+			select {
+			case <-time.After(interruptGrace):
+				cancel()
+			case <-exited:
+			}
+		case <-exited:
+		}
+	}()
+	exitErr := cmd.Wait()
+	close(exited)
 
-	sb, ss, err := c.parseIperfOutput(out)
-	res = &traffic.Result{
-		SendByte:   sb,
-		SendSecond: ss,
+	res := &traffic.Result{
+		WallSecond: time.Since(start).Seconds(),
+		Status:     traffic.StatusOK,
 	}
-	return res, err
+	sb, ss, cs, msg, err := c.parseIperfOutput(out.Bytes())
+	switch {
+	case ctx.Err() != nil:
+		// iperf3 may have been stopped before it could report
+		res.Status = traffic.StatusInterrupted
+		if err == nil {
+			res.SendByte, res.SendSecond, res.CompletionSecond = sb, ss, cs
+		}
+		return res, nil
+	case deadline.Err() != nil:
+		res.Status = traffic.StatusTimeout
+		res.Error = fmt.Sprintf("iperf3 did not end within %s", timeout)
+		if err == nil {
+			res.SendByte, res.SendSecond, res.CompletionSecond = sb, ss, cs
+		}
+	case err != nil:
+		res.Status = traffic.StatusParseError
+		res.Error = err.Error()
+	case msg != "":
+		res.Status = failureStatus(msg)
+		res.Error = msg
+	case exitErr != nil:
+		res.Status = traffic.StatusError
+		res.Error = exitErr.Error()
+	default:
+		res.SendByte, res.SendSecond, res.CompletionSecond = sb, ss, cs
+		return res, nil
+	}
+	fmt.Printf("[ERROR] Exec command: %s %s, output: %s, %s\n", iperf3, args, out.Bytes(), res.Error)
+	return res, nil
 }
 
-func (c *Client) parseIperfOutput(out []byte) (sb int64, ss float64, err error) {
-	var i interface{}
+// iperfOutput is the part of the JSON output of iperf3 which the client reads.
+type iperfOutput struct {
+	End struct {
+		SumSent     *iperfSum `json:"sum_sent"`
+		SumReceived *iperfSum `json:"sum_received"`
+		Sum         *iperfSum `json:"sum"`
+	} `json:"end"`
+	Error string `json:"error"`
+}
 
-	if err = json.Unmarshal(out, &i); err != nil {
-		return 0, 0, err
+type iperfSum struct {
+	Bytes   float64 `json:"bytes"`
+	Seconds float64 `json:"seconds"`
+}
+
+// parseIperfOutput returns the bytes and seconds iperf3 sent, the seconds until the receiver got the last
+// byte and the error iperf3 reported, if any.
+func (c *Client) parseIperfOutput(out []byte) (sb int64, ss, cs float64, msg string, err error) {
+	var o iperfOutput
+	if err = json.Unmarshal(out, &o); err != nil {
+		return 0, 0, 0, "", fmt.Errorf("invalid iperf3 output: %w", err)
 	}
 
 	log.Println(string(out))
 
-	if c.WindowSize == "" {
-		sb = int64(i.(map[string]interface{})["end"].(map[string]interface{})["sum_sent"].(map[string]interface{})["bytes"].(float64))
-		ss = i.(map[string]interface{})["end"].(map[string]interface{})["sum_sent"].(map[string]interface{})["seconds"].(float64)
-	} else {
-		sb = int64(i.(map[string]interface{})["end"].(map[string]interface{})["sum"].(map[string]interface{})["bytes"].(float64))
-		ss = i.(map[string]interface{})["end"].(map[string]interface{})["sum"].(map[string]interface{})["seconds"].(float64)
+	// TCP results have the sum of the sender, UDP results only a sum, and cycles of both protocols
+	// may be mixed in a plan
+	sum := o.End.SumSent
+	if sum == nil {
+		sum = o.End.Sum
+	}
+	if sum == nil {
+		if o.Error != "" {
+			return 0, 0, 0, o.Error, nil
+		}
+		return 0, 0, 0, "", fmt.Errorf("iperf3 output has no sum")
+	}
+	// the receiver of TCP tests ends after the sender, when the last byte of the flow has arrived
+	cs = sum.Seconds
+	if r := o.End.SumReceived; r != nil && r.Seconds > cs {
+		cs = r.Seconds
+	}
+	return int64(sum.Bytes), sum.Seconds, cs, o.Error, nil
+}
+
+// failureStatus returns the status of a cycle which iperf3 failed with the error msg.
+func failureStatus(msg string) string {
+	m := strings.ToLower(msg)
+	switch {
+	case strings.Contains(m, "connection refused"):
+		return traffic.StatusConnectRefused
+	case strings.Contains(m, "busy"):
+		return traffic.StatusServerBusy
+	case strings.Contains(m, "timed out") || strings.Contains(m, "timeout"):
+		return traffic.StatusTimeout
 	}
-	return sb, ss, nil
+	return traffic.StatusError
 }
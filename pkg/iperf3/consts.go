@@ -1,3 +1,32 @@
 package iperf3
 
+import "time"
+
 const iperf3 = "iperf3"
+
+// interruptGrace is how long an interrupted iperf3 has to report its results before it is killed.
+const interruptGrace = 3 * time.Second
+
+// runGrace is how long iperf3 may run beyond the send duration of a cycle and the connect timeout, to connect
+// and exchange the results with the server, before it is stopped.
+const runGrace = 10 * time.Second
+
+// Lag policies, what the client does with a cycle whose start is late by more than the maximum lag.
+const (
+	// LagRun runs late cycles right away, so that the run catches up during the following waits.
+	LagRun = "run"
+	// LagSkip skips late cycles.
+	LagSkip = "skip"
+	// LagCompress shortens late cycles so that they end when they were planned to end.
+	LagCompress = "compress"
+)
+
+// Failure policies, what the client does with a cycle which iperf3 failed to run.
+const (
+	// FailureAbort stops the run.
+	FailureAbort = "abort"
+	// FailureRetry runs the cycle again, up to Retries times with a backoff doubling after every attempt.
+	FailureRetry = "retry"
+	// FailureSkip keeps the failed cycle in the results and goes on with the next.
+	FailureSkip = "skip"
+)
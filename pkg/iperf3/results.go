@@ -0,0 +1,215 @@
+package iperf3
+
+import (
+	"encoding/csv"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/chez-shanpu/traffic-generator/pkg/file"
+	"github.com/chez-shanpu/traffic-generator/pkg/traffic"
+)
+
+// ResultWriter streams the results of a run as CSV, a row of every cycle as soon as it ends, so that long
+// runs can be followed and nothing is lost if the run crashes. The rows are in the order the cycles end,
+// which is not the order of the plan when flows run concurrently.
+type ResultWriter struct {
+	mu     sync.Mutex
+	f      *os.File
+	w      *csv.Writer
+	cols   resultColumns
+	params []*Param
+}
+
+// resultColumns are the optional columns of the results.
+type resultColumns struct {
+	multiFlow bool
+	sized     bool
+}
+
+func (cols resultColumns) head() []string {
+	head := []string{"Cycle"}
+	if cols.multiFlow {
+		head = append(head, "Flow")
+	}
+	head = append(head, "SendByte", "Bitrate", "SendSecond", "WaitMilliSecond")
+	if cols.sized {
+		head = append(head, "FlowBytes", "FlowCompletionSecond", "WallSecond")
+	}
+	return append(head, "PlannedStartSecond", "StartSecond", "Status", "Error")
+}
+
+// NewResultWriter creates out, or uses stdout if out is empty, and writes the header of the results.
+func (c Client) NewResultWriter(out string) (*ResultWriter, error) {
+	f, err := file.Create(out)
+	if err != nil {
+		return nil, err
+	}
+	return c.newResultWriter(f)
+}
+
+func (c Client) newResultWriter(f *os.File) (*ResultWriter, error) {
+	rw := &ResultWriter{
+		f: f,
+		w: csv.NewWriter(f),
+		cols: resultColumns{
+			multiFlow: c.multiFlow(),
+			sized:     traffic.Params(c.Params).HasFlowBytes(),
+		},
+		params: c.Params,
+	}
+	if err := rw.w.Write(rw.cols.head()); err != nil {
+		return nil, err
+	}
+	rw.w.Flush()
+	return rw, rw.w.Error()
+}
+
+// Write writes the result of a cycle and flushes it. It is safe to call from the goroutines of every flow.
+func (rw *ResultWriter) Write(r *traffic.Result) error {
+	p := rw.params[r.Cycle]
+
+	var line []string
+	line = append(line, strconv.Itoa(r.Cycle))
+	if rw.cols.multiFlow {
+		line = append(line, strconv.Itoa(r.Flow))
+	}
+	line = append(line, strconv.FormatInt(r.SendByte, 10))
+	line = append(line, p.Bitrate.String())
+	line = append(line, strconv.FormatFloat(r.SendSecond, 'f', -1, 64))
+	line = append(line, strconv.FormatInt(int64(p.WaitMilliSeconds), 10))
+	if rw.cols.sized {
+		line = append(line, strconv.FormatInt(p.FlowBytes, 10))
+		line = append(line, strconv.FormatFloat(r.CompletionSecond, 'f', -1, 64))
+		line = append(line, strconv.FormatFloat(r.WallSecond, 'f', 3, 64))
+	}
+	line = append(line, strconv.FormatFloat(r.PlannedStartSecond, 'f', 3, 64))
+	if r.Started() {
+		line = append(line, strconv.FormatFloat(r.StartSecond, 'f', 3, 64))
+	} else {
+		line = append(line, "")
+	}
+	line = append(line, r.Status, r.Error)
+
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if err := rw.w.Write(line); err != nil {
+		return err
+	}
+	rw.w.Flush()
+	return rw.w.Error()
+}
+
+// WriteTotals writes the totals of every flow of a multi-flow plan and the totals of the run, of the cycles
+// which have results.
+func (rw *ResultWriter) WriteTotals(rs traffic.Results) error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	if rw.cols.multiFlow {
+		for _, f := range traffic.Params(rw.params).ByFlow() {
+			var frs traffic.Results
+			var ps traffic.Params
+			for _, r := range rs {
+				if r != nil && r.Flow == f[0].Flow {
+					frs = append(frs, r)
+					ps = append(ps, rw.params[r.Cycle])
+				}
+			}
+			if len(frs) == 0 {
+				continue
+			}
+			if err := rw.w.Write(rw.cols.totalLine(strconv.Itoa(f[0].Flow), frs, ps)); err != nil {
+				return err
+			}
+		}
+	}
+
+	var frs traffic.Results
+	var ps traffic.Params
+	for _, r := range rs {
+		if r != nil {
+			frs = append(frs, r)
+			ps = append(ps, rw.params[r.Cycle])
+		}
+	}
+	if err := rw.w.Write(rw.cols.totalLine("-", frs, ps)); err != nil {
+		return err
+	}
+	rw.w.Flush()
+	return rw.w.Error()
+}
+
+// Close closes the file of the results unless it is stdout.
+func (rw *ResultWriter) Close() error {
+	if rw.f == os.Stdout {
+		return nil
+	}
+	return rw.f.Close()
+}
+
+// OutputSummary writes the totals of the results to out, with the header of the results.
+func (c Client) OutputSummary(rs traffic.Results, out string) error {
+	rw, err := c.NewResultWriter(out)
+	if err != nil {
+		return err
+	}
+	defer rw.Close()
+	return rw.WriteTotals(rs)
+}
+
+func (c Client) OutputResults(rs traffic.Results, out string) error {
+	f, err := file.Create(out)
+	if err != nil {
+		return err
+	}
+	return c.OutputResultsCSV(rs, f)
+}
+
+// OutputResultsCSV writes the results of every cycle followed by the totals of every flow of a multi-flow
+// plan and the totals of the run. Plans with flow sizes get the flow completion time of every cycle reported
+// by iperf3, the time from the start of the test until the receiver got the last byte, and the wall-clock
+// time iperf3 ran including connection setup. Cycles which did not start because the run was interrupted
+// have no results and are left out.
+func (c Client) OutputResultsCSV(rs traffic.Results, f *os.File) error {
+	rw, err := c.newResultWriter(f)
+	if err != nil {
+		return err
+	}
+	for _, r := range rs {
+		if r == nil {
+			continue
+		}
+		if err := rw.Write(r); err != nil {
+			return err
+		}
+	}
+	return rw.WriteTotals(rs)
+}
+
+func (cols resultColumns) totalLine(flow string, rs traffic.Results, ps traffic.Params) []string {
+	var send traffic.Second
+	var wait traffic.MilliSecond
+	var size int64
+	for _, p := range ps {
+		send += p.SendSeconds
+		wait += p.WaitMilliSeconds
+		size += p.FlowBytes
+	}
+
+	var line []string
+	line = append(line, "Total")
+	if cols.multiFlow {
+		line = append(line, flow)
+	}
+	line = append(line, strconv.FormatInt(rs.TotalSendBytes(), 10))
+	line = append(line, "-")
+	line = append(line, strconv.FormatInt(int64(send), 10))
+	line = append(line, strconv.FormatFloat(float64(wait), 'f', -1, 64))
+	if cols.sized {
+		line = append(line, strconv.FormatInt(size, 10))
+		line = append(line, strconv.FormatFloat(rs.TotalCompletionSeconds(), 'f', -1, 64))
+		line = append(line, strconv.FormatFloat(rs.TotalWallSeconds(), 'f', 3, 64))
+	}
+	return append(line, "-", "-", "-", "-")
+}
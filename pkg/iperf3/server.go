@@ -7,20 +7,67 @@ import (
 	"os"
 	"os/exec"
 	"strconv"
+	"strings"
 
 	"github.com/chez-shanpu/traffic-generator/pkg/file"
 
 	"github.com/chez-shanpu/traffic-generator/pkg/traffic"
 )
 
-type Server struct{}
+// Server runs iperf3 servers which handle one client connection at a time.
+type Server struct {
+	// Port is the listening port, or the default port of iperf3 if empty.
+	Port string
+}
 
 func NewServer() *Server {
 	return &Server{}
 }
 
+// NewServers returns a server for each port of ports, a comma separated list of ports and
+// port ranges like 5201-5204.
+func NewServers(ports string) ([]*Server, error) {
+	ps, err := ParsePorts(ports)
+	if err != nil {
+		return nil, err
+	}
+
+	ss := make([]*Server, len(ps))
+	for i, p := range ps {
+		ss[i] = &Server{Port: p}
+	}
+	return ss, nil
+}
+
+// ParsePorts parses a comma separated list of ports and port ranges like 5201-5204.
+func ParsePorts(ports string) ([]string, error) {
+	var ps []string
+	for _, r := range strings.Split(ports, ",") {
+		r = strings.TrimSpace(r)
+		lo, hi := r, r
+		if i := strings.Index(r, "-"); i >= 0 {
+			lo, hi = r[:i], r[i+1:]
+		}
+		l, err := strconv.Atoi(lo)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q", r)
+		}
+		h, err := strconv.Atoi(hi)
+		if err != nil || h < l {
+			return nil, fmt.Errorf("invalid port range %q", r)
+		}
+		if l < 1 || h > 65535 {
+			return nil, fmt.Errorf("port range %q is out of range", r)
+		}
+		for p := l; p <= h; p++ {
+			ps = append(ps, strconv.Itoa(p))
+		}
+	}
+	return ps, nil
+}
+
 func (s *Server) Run() (res *traffic.Result, err error) {
-	args := makeServerArgs()
+	args := s.makeServerArgs()
 	out, err := exec.Command(iperf3, args...).CombinedOutput()
 	if err != nil {
 		return nil, fmt.Errorf("[ERROR] Exec command: %s %s, output: %s, %s", iperf3, args, out, err)
@@ -64,12 +111,16 @@ func (s *Server) OutputResultCSV(ress traffic.Results, f *os.File) error {
 	return w.Write(line)
 }
 
-func makeServerArgs() []string {
-	return []string{
+func (s *Server) makeServerArgs() []string {
+	args := []string{
 		"-s",
 		"-1",
 		"-J",
 	}
+	if s.Port != "" {
+		args = append(args, "-p", s.Port)
+	}
+	return args
 }
 
 func parseIperfServerOutput(out []byte) (sb int64, ss float64, err error) {
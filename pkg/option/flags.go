@@ -3,64 +3,237 @@ package option
 import "github.com/spf13/viper"
 
 const (
-	Bitrate       = "bitrate"
-	BitrateLambda = "bitrate-lambda"
-	BitrateUnit   = "bitrate-unit"
-	Cycle         = "cycle"
-	DstAddr       = "dst-addr"
-	DstPort       = "dst-port"
-	Flowlabel     = "flowlabel"
-	IPv6          = "ipv6"
-	Mss           = "mss"
-	Out           = "out"
-	Param         = "param"
-	Seed          = "seed"
-	SendLambda    = "send-lambda"
-	SendSeconds   = "send-seconds"
-	UDP           = "udp"
-	WaitLambda    = "wait-lambda"
-	WaitSeconds   = "wait-seconds"
-	WindowSize    = "window"
+	ArrivalDist      = "arrival-dist"
+	ArrivalRate      = "arrival-rate"
+	Bitrate          = "bitrate"
+	BitrateDist      = "bitrate-dist"
+	BitrateFactor    = "bitrate-factor"
+	BitrateLambda    = "bitrate-lambda"
+	BitrateMax       = "bitrate-max"
+	BitrateMin       = "bitrate-min"
+	BitrateUnit      = "bitrate-unit"
+	Checkpoint       = "checkpoint"
+	ConfigFile       = "config"
+	ConnectTimeout   = "connect-timeout"
+	ConstraintMethod = "constraint-method"
+	Correlation      = "correlation"
+	Cycle            = "cycle"
+	Cycles           = "cycles"
+	DstAddr          = "dst-addr"
+	DstPort          = "dst-port"
+	Endpoints        = "endpoints"
+	EndpointsFile    = "endpoints-file"
+	Envelope         = "envelope"
+	FitCandidates    = "candidates"
+	Flowlabel        = "flowlabel"
+	Flows            = "flows"
+	Format           = "format"
+	FromPcap         = "from-pcap"
+	HotspotFraction  = "hotspot-fraction"
+	Hotspots         = "hotspots"
+	Hurst            = "hurst"
+	IdleGap          = "idle-gap"
+	Input            = "input"
+	IPv6             = "ipv6"
+	LagPolicy        = "lag-policy"
+	MarkovModel      = "mmpp"
+	Matrix           = "matrix"
+	MaxDuration      = "max-duration"
+	MaxFailures      = "max-failures"
+	MaxLag           = "max-lag"
+	Model            = "model"
+	Mss              = "mss"
+	OnFailure        = "on-failure"
+	Out              = "out"
+	Parallel         = "parallel"
+	Param            = "param"
+	Params           = "params"
+	PcapFlows        = "pcap-flows"
+	PerSource        = "per-source"
+	Ports            = "ports"
+	Resume           = "resume"
+	Retries          = "retries"
+	RetryBackoff     = "retry-backoff"
+	Reverse          = "reverse"
+	Seed             = "seed"
+	SendDist         = "send-dist"
+	SendFactor       = "send-factor"
+	SendLambda       = "send-lambda"
+	SendMax          = "send-max"
+	SendMin          = "send-min"
+	SendSeconds      = "send-seconds"
+	SizeDist         = "size-dist"
+	SrcAddr          = "src-addr"
+	Summary          = "summary"
+	TargetBytes      = "target-bytes"
+	TargetTolerance  = "target-tolerance"
+	TimeCompression  = "time-compression"
+	TimeWindow       = "time-window"
+	TOS              = "tos"
+	UDP              = "udp"
+	WaitDist         = "wait-dist"
+	WaitFactor       = "wait-factor"
+	WaitLambda       = "wait-lambda"
+	WaitSeconds      = "wait-seconds"
+	WindowSize       = "window"
+	Workload         = "workload"
 )
 
 type Config struct {
-	Bitrate       string
-	BitrateLambda float64
-	BitrateUnit   string
-	Cycle         int
-	DstAddr       string
-	DstPort       string
-	Flowlabel     int64
-	IPv6          bool
-	Mss           int64
-	Out           string
-	Param         string
-	Seed          uint64
-	SendLambda    float64
-	SendSeconds   int64
-	UDP           bool
-	WaitLambda    float64
-	WaitSeconds   int64
-	WindowSize    string
+	ArrivalDist      string
+	ArrivalRate      float64
+	Bitrate          string
+	BitrateDist      string
+	BitrateFactor    float64
+	BitrateLambda    float64
+	BitrateMax       string
+	BitrateMin       string
+	BitrateUnit      string
+	Checkpoint       string
+	ConfigFile       string
+	ConnectTimeout   float64
+	ConstraintMethod string
+	Correlation      string
+	Cycle            int
+	Cycles           string
+	DstAddr          string
+	DstPort          string
+	Endpoints        []string
+	EndpointsFile    string
+	Envelope         string
+	FitCandidates    []string
+	Flowlabel        int64
+	Flows            int
+	Format           string
+	FromPcap         string
+	HotspotFraction  float64
+	Hotspots         int
+	Hurst            float64
+	IdleGap          float64
+	Input            string
+	IPv6             bool
+	LagPolicy        string
+	MarkovModel      string
+	Matrix           string
+	MaxDuration      float64
+	MaxFailures      int
+	MaxLag           float64
+	Model            string
+	Mss              int64
+	OnFailure        string
+	Out              string
+	Parallel         int
+	Param            string
+	Params           []string
+	PcapFlows        int
+	PerSource        bool
+	Ports            string
+	Resume           bool
+	Retries          int
+	RetryBackoff     float64
+	Reverse          bool
+	Seed             uint64
+	SendDist         string
+	SendFactor       float64
+	SendLambda       float64
+	SendMax          int64
+	SendMin          int64
+	SendSeconds      int64
+	SizeDist         string
+	SrcAddr          string
+	Summary          string
+	TargetBytes      int64
+	TargetTolerance  float64
+	TimeCompression  float64
+	TimeWindow       string
+	TOS              string
+	UDP              bool
+	WaitDist         string
+	WaitFactor       float64
+	WaitLambda       float64
+	WaitSeconds      int64
+	WindowSize       string
+	Workload         string
 }
 
 func (c *Config) Populate() {
-	c.Bitrate = viper.GetString(Bitrate)
-	c.BitrateLambda = viper.GetFloat64(BitrateLambda)
-	c.BitrateUnit = viper.GetString(BitrateUnit)
-	c.Cycle = viper.GetInt(Cycle)
-	c.DstAddr = viper.GetString(DstAddr)
-	c.DstPort = viper.GetString(DstPort)
-	c.Flowlabel = viper.GetInt64(Flowlabel)
-	c.IPv6 = viper.GetBool(IPv6)
-	c.Mss = viper.GetInt64(Mss)
-	c.Out = viper.GetString(Out)
-	c.Param = viper.GetString(Param)
-	c.Seed = viper.GetUint64(Seed)
-	c.SendLambda = viper.GetFloat64(SendLambda)
-	c.SendSeconds = viper.GetInt64(SendSeconds)
-	c.UDP = viper.GetBool(UDP)
-	c.WaitLambda = viper.GetFloat64(WaitLambda)
-	c.WaitSeconds = viper.GetInt64(WaitSeconds)
-	c.WindowSize = viper.GetString(WindowSize)
+	c.PopulateFrom(viper.GetViper())
+}
+
+// PopulateFrom sets the configuration from v.
+func (c *Config) PopulateFrom(v *viper.Viper) {
+	c.ArrivalDist = v.GetString(ArrivalDist)
+	c.ArrivalRate = v.GetFloat64(ArrivalRate)
+	c.Bitrate = v.GetString(Bitrate)
+	c.BitrateDist = v.GetString(BitrateDist)
+	c.BitrateFactor = v.GetFloat64(BitrateFactor)
+	c.BitrateLambda = v.GetFloat64(BitrateLambda)
+	c.BitrateMax = v.GetString(BitrateMax)
+	c.BitrateMin = v.GetString(BitrateMin)
+	c.BitrateUnit = v.GetString(BitrateUnit)
+	c.Checkpoint = v.GetString(Checkpoint)
+	c.ConfigFile = v.GetString(ConfigFile)
+	c.ConnectTimeout = v.GetFloat64(ConnectTimeout)
+	c.ConstraintMethod = v.GetString(ConstraintMethod)
+	c.Correlation = v.GetString(Correlation)
+	c.Cycle = v.GetInt(Cycle)
+	c.Cycles = v.GetString(Cycles)
+	c.DstAddr = v.GetString(DstAddr)
+	c.DstPort = v.GetString(DstPort)
+	c.Endpoints = v.GetStringSlice(Endpoints)
+	c.EndpointsFile = v.GetString(EndpointsFile)
+	c.Envelope = v.GetString(Envelope)
+	c.FitCandidates = v.GetStringSlice(FitCandidates)
+	c.Flowlabel = v.GetInt64(Flowlabel)
+	c.Flows = v.GetInt(Flows)
+	c.Format = v.GetString(Format)
+	c.FromPcap = v.GetString(FromPcap)
+	c.HotspotFraction = v.GetFloat64(HotspotFraction)
+	c.Hotspots = v.GetInt(Hotspots)
+	c.Hurst = v.GetFloat64(Hurst)
+	c.IdleGap = v.GetFloat64(IdleGap)
+	c.Input = v.GetString(Input)
+	c.IPv6 = v.GetBool(IPv6)
+	c.LagPolicy = v.GetString(LagPolicy)
+	c.MarkovModel = v.GetString(MarkovModel)
+	c.Matrix = v.GetString(Matrix)
+	c.MaxDuration = v.GetFloat64(MaxDuration)
+	c.MaxFailures = v.GetInt(MaxFailures)
+	c.MaxLag = v.GetFloat64(MaxLag)
+	c.Model = v.GetString(Model)
+	c.Mss = v.GetInt64(Mss)
+	c.OnFailure = v.GetString(OnFailure)
+	c.Out = v.GetString(Out)
+	c.Parallel = v.GetInt(Parallel)
+	c.Param = v.GetString(Param)
+	c.Params = v.GetStringSlice(Params)
+	c.PcapFlows = v.GetInt(PcapFlows)
+	c.PerSource = v.GetBool(PerSource)
+	c.Ports = v.GetString(Ports)
+	c.Resume = v.GetBool(Resume)
+	c.Retries = v.GetInt(Retries)
+	c.RetryBackoff = v.GetFloat64(RetryBackoff)
+	c.Reverse = v.GetBool(Reverse)
+	c.Seed = v.GetUint64(Seed)
+	c.SendDist = v.GetString(SendDist)
+	c.SendFactor = v.GetFloat64(SendFactor)
+	c.SendLambda = v.GetFloat64(SendLambda)
+	c.SendMax = v.GetInt64(SendMax)
+	c.SendMin = v.GetInt64(SendMin)
+	c.SendSeconds = v.GetInt64(SendSeconds)
+	c.SizeDist = v.GetString(SizeDist)
+	c.SrcAddr = v.GetString(SrcAddr)
+	c.Summary = v.GetString(Summary)
+	c.TargetBytes = v.GetInt64(TargetBytes)
+	c.TargetTolerance = v.GetFloat64(TargetTolerance)
+	c.TimeCompression = v.GetFloat64(TimeCompression)
+	c.TimeWindow = v.GetString(TimeWindow)
+	c.TOS = v.GetString(TOS)
+	c.UDP = v.GetBool(UDP)
+	c.WaitDist = v.GetString(WaitDist)
+	c.WaitFactor = v.GetFloat64(WaitFactor)
+	c.WaitLambda = v.GetFloat64(WaitLambda)
+	c.WaitSeconds = v.GetInt64(WaitSeconds)
+	c.WindowSize = v.GetString(WindowSize)
+	c.Workload = v.GetString(Workload)
 }
@@ -0,0 +1,79 @@
+package option
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// FlowOverrides is the key of the config file listing the settings which override
+// the global configuration for each flow, e.g.
+//
+//	flow-overrides:
+//	- send-dist: pareto:xm=1,alpha=1.5
+//	  dst-port: 5202
+//	- bitrate: 10M
+const FlowOverrides = "flow-overrides"
+
+// FlowConfigs returns the configuration of each of n flows, the global configuration overridden by
+// the corresponding entry of the flow-overrides list. Flows without an entry use the global configuration.
+func (c Config) FlowConfigs(n int) ([]Config, error) {
+	var overrides []interface{}
+	if viper.IsSet(FlowOverrides) {
+		var err error
+		if overrides, err = cast.ToSliceE(viper.Get(FlowOverrides)); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", FlowOverrides, err)
+		}
+	}
+	if len(overrides) > n {
+		n = len(overrides)
+	}
+
+	cfgs := make([]Config, n)
+	for i := range cfgs {
+		if i >= len(overrides) {
+			cfgs[i] = c
+			continue
+		}
+
+		o, err := cast.ToStringMapE(overrides[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s of flow %d: %w", FlowOverrides, i, err)
+		}
+		if cfgs[i], err = Override(o); err != nil {
+			return nil, fmt.Errorf("invalid %s of flow %d: %w", FlowOverrides, i, err)
+		}
+	}
+	return cfgs, nil
+}
+
+// Override returns the global configuration overridden by the settings, a map from flag names to values.
+// Settings whose keys are not flags of the command are refused, so that typos are not silently ignored.
+func Override(settings map[string]interface{}) (Config, error) {
+	v := viper.New()
+	known := map[string]bool{}
+	for _, k := range viper.AllKeys() {
+		v.SetDefault(k, viper.Get(k))
+		known[k] = true
+	}
+	var unknown []string
+	for k := range settings {
+		if !known[strings.ToLower(k)] {
+			unknown = append(unknown, k)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return Config{}, fmt.Errorf("unknown settings %s", strings.Join(unknown, ", "))
+	}
+	if err := v.MergeConfigMap(settings); err != nil {
+		return Config{}, err
+	}
+
+	c := Config{}
+	c.PopulateFrom(v)
+	return c, nil
+}
@@ -0,0 +1,174 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+// Link types of the packets which can be decoded.
+const (
+	LinkTypeNull     = 0
+	LinkTypeEthernet = 1
+	LinkTypeRaw      = 101
+	LinkTypeLoop     = 108
+	LinkTypeLinuxSLL = 113
+)
+
+const (
+	protoTCP = 6
+	protoUDP = 17
+)
+
+// FlowKey is the 5-tuple of a unidirectional flow.
+type FlowKey struct {
+	Protocol uint8
+	SrcAddr  [16]byte
+	DstAddr  [16]byte
+	SrcPort  uint16
+	DstPort  uint16
+}
+
+func (k FlowKey) ProtocolName() string {
+	switch k.Protocol {
+	case protoTCP:
+		return "tcp"
+	case protoUDP:
+		return "udp"
+	}
+	return fmt.Sprintf("proto-%d", k.Protocol)
+}
+
+func (k FlowKey) Src() net.IP {
+	return net.IP(k.SrcAddr[:])
+}
+
+func (k FlowKey) Dst() net.IP {
+	return net.IP(k.DstAddr[:])
+}
+
+func (k FlowKey) String() string {
+	return fmt.Sprintf("%s %s -> %s", k.ProtocolName(),
+		net.JoinHostPort(k.Src().String(), fmt.Sprint(k.SrcPort)),
+		net.JoinHostPort(k.Dst().String(), fmt.Sprint(k.DstPort)))
+}
+
+// Flow decodes the 5-tuple of an IPv4 or IPv6 packet carrying TCP or UDP.
+// It returns false for other packets.
+func (p *Packet) Flow() (FlowKey, bool) {
+	ip, ok := p.network()
+	if !ok || len(ip) < 1 {
+		return FlowKey{}, false
+	}
+
+	var k FlowKey
+	var l4 []byte
+	switch ip[0] >> 4 {
+	case 4:
+		if len(ip) < 20 {
+			return FlowKey{}, false
+		}
+		ihl := int(ip[0]&0x0f) * 4
+		if ihl < 20 || len(ip) < ihl {
+			return FlowKey{}, false
+		}
+		if binary.BigEndian.Uint16(ip[6:])&0x1fff != 0 {
+			// non-first fragments carry no transport header
+			return FlowKey{}, false
+		}
+		k.Protocol = ip[9]
+		copy(k.SrcAddr[:], net.IP(ip[12:16]).To16())
+		copy(k.DstAddr[:], net.IP(ip[16:20]).To16())
+		l4 = ip[ihl:]
+	case 6:
+		if len(ip) < 40 {
+			return FlowKey{}, false
+		}
+		copy(k.SrcAddr[:], ip[8:24])
+		copy(k.DstAddr[:], ip[24:40])
+		next, rest, ok := skipIPv6Extensions(ip[6], ip[40:])
+		if !ok {
+			return FlowKey{}, false
+		}
+		k.Protocol = next
+		l4 = rest
+	default:
+		return FlowKey{}, false
+	}
+
+	if k.Protocol != protoTCP && k.Protocol != protoUDP {
+		return FlowKey{}, false
+	}
+	if len(l4) < 4 {
+		return FlowKey{}, false
+	}
+	k.SrcPort = binary.BigEndian.Uint16(l4)
+	k.DstPort = binary.BigEndian.Uint16(l4[2:])
+	return k, true
+}
+
+// network returns the network layer of the packet.
+func (p *Packet) network() ([]byte, bool) {
+	d := p.Data
+	switch p.LinkType {
+	case LinkTypeEthernet:
+		if len(d) < 14 {
+			return nil, false
+		}
+		etherType := binary.BigEndian.Uint16(d[12:])
+		d = d[14:]
+		// VLAN tags
+		for etherType == 0x8100 || etherType == 0x88a8 {
+			if len(d) < 4 {
+				return nil, false
+			}
+			etherType = binary.BigEndian.Uint16(d[2:])
+			d = d[4:]
+		}
+		if etherType != 0x0800 && etherType != 0x86dd {
+			return nil, false
+		}
+		return d, true
+	case LinkTypeRaw:
+		return d, true
+	case LinkTypeNull, LinkTypeLoop:
+		if len(d) < 4 {
+			return nil, false
+		}
+		return d[4:], true
+	case LinkTypeLinuxSLL:
+		if len(d) < 16 {
+			return nil, false
+		}
+		return d[16:], true
+	}
+	return nil, false
+}
+
+func skipIPv6Extensions(next uint8, d []byte) (uint8, []byte, bool) {
+	for {
+		switch next {
+		case 0, 43, 60:
+			// hop-by-hop, routing and destination options
+			if len(d) < 8 {
+				return 0, nil, false
+			}
+			l := (int(d[1]) + 1) * 8
+			if len(d) < l {
+				return 0, nil, false
+			}
+			next, d = d[0], d[l:]
+		case 44:
+			// fragment
+			if len(d) < 8 {
+				return 0, nil, false
+			}
+			if binary.BigEndian.Uint16(d[2:])&0xfff8 != 0 {
+				return 0, nil, false
+			}
+			next, d = d[0], d[8:]
+		default:
+			return next, d, true
+		}
+	}
+}
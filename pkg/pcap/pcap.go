@@ -0,0 +1,310 @@
+// Package pcap reads packets from pcap and pcapng files without libpcap.
+package pcap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	magicMicroseconds = 0xa1b2c3d4
+	magicNanoseconds  = 0xa1b23c4d
+	magicPcapng       = 0x0a0d0d0a
+	byteOrderMagic    = 0x1a2b3c4d
+)
+
+// maxPacketLength and maxBlockLength bound the lengths read from a capture, so that a corrupt file cannot
+// make the reader allocate more than a packet or a block can hold. They are the limits of libpcap, and packets
+// of pcap files may be longer than maxPacketLength up to their snap length.
+const (
+	maxPacketLength = 262144
+	maxBlockLength  = 16 * 1024 * 1024
+)
+
+const (
+	blockInterfaceDescription = 0x00000001
+	blockEnhancedPacket       = 0x00000006
+	blockSectionHeader        = 0x0a0d0d0a
+)
+
+// Packet is a captured packet.
+type Packet struct {
+	Timestamp time.Time
+	// Length is the length of the packet on the wire, which may be larger than Data.
+	Length   int
+	LinkType uint16
+	Data     []byte
+}
+
+// Reader reads packets from a pcap or pcapng file.
+type Reader struct {
+	f    *os.File
+	r    *bufio.Reader
+	next func() (*Packet, error)
+
+	// pcap
+	order    binary.ByteOrder
+	nano     bool
+	linkType uint16
+	snapLen  uint32
+
+	// pcapng
+	interfaces []iface
+}
+
+type iface struct {
+	linkType uint16
+	// resolution is the duration of a timestamp unit
+	resolution time.Duration
+	// perSecond is the number of timestamp units per second when they are finer than a nanosecond
+	perSecond uint64
+}
+
+// Open opens a pcap or pcapng file. The format is detected from its magic number.
+func Open(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Reader{f: f, r: bufio.NewReader(f)}
+	magic, err := r.r.Peek(4)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	switch {
+	case binary.LittleEndian.Uint32(magic) == magicPcapng:
+		r.next = r.nextPcapng
+	default:
+		if err := r.readPcapHeader(); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		r.next = r.nextPcap
+	}
+	return r, nil
+}
+
+func (r *Reader) Close() error {
+	return r.f.Close()
+}
+
+// Next returns the next packet, or io.EOF at the end of the file.
+func (r *Reader) Next() (*Packet, error) {
+	return r.next()
+}
+
+func (r *Reader) readPcapHeader() error {
+	h := make([]byte, 24)
+	if _, err := io.ReadFull(r.r, h); err != nil {
+		return err
+	}
+
+	switch {
+	case binary.LittleEndian.Uint32(h) == magicMicroseconds:
+		r.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(h) == magicMicroseconds:
+		r.order = binary.BigEndian
+	case binary.LittleEndian.Uint32(h) == magicNanoseconds:
+		r.order, r.nano = binary.LittleEndian, true
+	case binary.BigEndian.Uint32(h) == magicNanoseconds:
+		r.order, r.nano = binary.BigEndian, true
+	default:
+		return fmt.Errorf("not a pcap or pcapng file")
+	}
+	r.snapLen = r.order.Uint32(h[16:])
+	r.linkType = uint16(r.order.Uint32(h[20:]))
+	return nil
+}
+
+func (r *Reader) nextPcap() (*Packet, error) {
+	h := make([]byte, 16)
+	if _, err := io.ReadFull(r.r, h); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("truncated packet header")
+		}
+		return nil, err
+	}
+
+	sec := int64(r.order.Uint32(h))
+	frac := int64(r.order.Uint32(h[4:]))
+	capLen := r.order.Uint32(h[8:])
+	origLen := r.order.Uint32(h[12:])
+	if capLen > maxPacketLength && (capLen > r.snapLen || capLen > maxBlockLength) {
+		return nil, fmt.Errorf("invalid captured packet length %d", capLen)
+	}
+
+	data := make([]byte, capLen)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		return nil, fmt.Errorf("truncated packet: %w", err)
+	}
+
+	if !r.nano {
+		frac *= 1000
+	}
+	return &Packet{
+		Timestamp: time.Unix(sec, frac),
+		Length:    int(origLen),
+		LinkType:  r.linkType,
+		Data:      data,
+	}, nil
+}
+
+func (r *Reader) nextPcapng() (*Packet, error) {
+	for {
+		typ, body, err := r.readBlock()
+		if err != nil {
+			return nil, err
+		}
+
+		switch typ {
+		case blockSectionHeader:
+			r.interfaces = nil
+		case blockInterfaceDescription:
+			if len(body) < 8 {
+				return nil, fmt.Errorf("truncated interface description block")
+			}
+			r.interfaces = append(r.interfaces, r.parseInterface(body))
+		case blockEnhancedPacket:
+			if len(body) < 20 {
+				return nil, fmt.Errorf("truncated enhanced packet block")
+			}
+			id := r.order.Uint32(body)
+			if int(id) >= len(r.interfaces) {
+				return nil, fmt.Errorf("packet of undefined interface %d", id)
+			}
+			ifc := r.interfaces[id]
+			ts := uint64(r.order.Uint32(body[4:]))<<32 | uint64(r.order.Uint32(body[8:]))
+			capLen := r.order.Uint32(body[12:])
+			origLen := r.order.Uint32(body[16:])
+			if int(capLen) > len(body)-20 {
+				return nil, fmt.Errorf("truncated enhanced packet block")
+			}
+			return &Packet{
+				Timestamp: ifc.time(ts),
+				Length:    int(origLen),
+				LinkType:  ifc.linkType,
+				Data:      body[20 : 20+capLen],
+			}, nil
+		}
+		// other blocks carry no timestamped packets
+	}
+}
+
+// readBlock reads a pcapng block and returns its type and body.
+func (r *Reader) readBlock() (uint32, []byte, error) {
+	h := make([]byte, 8)
+	if _, err := io.ReadFull(r.r, h); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return 0, nil, fmt.Errorf("truncated block header")
+		}
+		return 0, nil, err
+	}
+
+	if binary.LittleEndian.Uint32(h) == blockSectionHeader {
+		// the byte order of a section is given by its header
+		bom := make([]byte, 4)
+		if _, err := io.ReadFull(r.r, bom); err != nil {
+			return 0, nil, fmt.Errorf("truncated section header block")
+		}
+		switch {
+		case binary.LittleEndian.Uint32(bom) == byteOrderMagic:
+			r.order = binary.LittleEndian
+		case binary.BigEndian.Uint32(bom) == byteOrderMagic:
+			r.order = binary.BigEndian
+		default:
+			return 0, nil, fmt.Errorf("invalid byte order magic of section header block")
+		}
+		total := r.order.Uint32(h[4:])
+		if total < 16 || total%4 != 0 || total > maxBlockLength {
+			return 0, nil, fmt.Errorf("invalid section header block length %d", total)
+		}
+		rest := make([]byte, total-12)
+		if _, err := io.ReadFull(r.r, rest); err != nil {
+			return 0, nil, fmt.Errorf("truncated section header block")
+		}
+		return blockSectionHeader, nil, nil
+	}
+
+	if r.order == nil {
+		return 0, nil, fmt.Errorf("pcapng block before the section header")
+	}
+	typ := r.order.Uint32(h)
+	total := r.order.Uint32(h[4:])
+	if total < 12 || total%4 != 0 || total > maxBlockLength {
+		return 0, nil, fmt.Errorf("invalid block length %d", total)
+	}
+	rest := make([]byte, total-8)
+	if _, err := io.ReadFull(r.r, rest); err != nil {
+		return 0, nil, fmt.Errorf("truncated block")
+	}
+	// the body excludes the trailing copy of the block length
+	return typ, rest[:len(rest)-4], nil
+}
+
+func (r *Reader) parseInterface(body []byte) iface {
+	ifc := iface{
+		linkType:   r.order.Uint16(body),
+		resolution: time.Microsecond,
+	}
+
+	// options follow the link type, reserved and snap length fields
+	opts := body[8:]
+	for len(opts) >= 4 {
+		code := r.order.Uint16(opts)
+		l := int(r.order.Uint16(opts[2:]))
+		if code == 0 || 4+l > len(opts) {
+			break
+		}
+		if code == 9 && l >= 1 {
+			// if_tsresol
+			ifc.setResolution(opts[4])
+		}
+		// options are padded to 32 bits, and the padding of the last one may be missing
+		n := 4 + (l+3)/4*4
+		if n > len(opts) {
+			break
+		}
+		opts = opts[n:]
+	}
+	return ifc
+}
+
+// setResolution sets the timestamp resolution given by the if_tsresol option v, a negative power of 10, or of 2
+// if the high bit is set. Resolutions finer than the timestamps can hold are ignored.
+func (ifc *iface) setResolution(v byte) {
+	var perSecond uint64 = 1
+	if v&0x80 == 0 {
+		if v > 19 {
+			return
+		}
+		for i := 0; i < int(v); i++ {
+			perSecond *= 10
+		}
+	} else {
+		if v&0x7f > 63 {
+			return
+		}
+		perSecond = 1 << (v & 0x7f)
+	}
+
+	ifc.resolution, ifc.perSecond = 0, perSecond
+	if perSecond <= uint64(time.Second) && uint64(time.Second)%perSecond == 0 {
+		ifc.resolution = time.Second / time.Duration(perSecond)
+	}
+}
+
+func (ifc iface) time(ts uint64) time.Time {
+	if ifc.resolution != 0 {
+		return time.Unix(0, 0).Add(time.Duration(ts) * ifc.resolution)
+	}
+	sec := ts / ifc.perSecond
+	frac := ts % ifc.perSecond
+	return time.Unix(int64(sec), int64(float64(frac)/float64(ifc.perSecond)*float64(time.Second)))
+}
@@ -0,0 +1,261 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func le32(vs ...uint32) []byte {
+	b := make([]byte, 4*len(vs))
+	for i, v := range vs {
+		binary.LittleEndian.PutUint32(b[4*i:], v)
+	}
+	return b
+}
+
+func pcapHeader(magic, snapLen uint32) []byte {
+	return append(le32(magic, 0x00040002, 0, 0, snapLen), le32(1)...)
+}
+
+func pcapPacket(sec, frac uint32, data []byte) []byte {
+	return append(le32(sec, frac, uint32(len(data)), uint32(len(data))), data...)
+}
+
+// block builds a little-endian pcapng block of type typ with the given body, padded to 32 bits.
+func block(typ uint32, body []byte) []byte {
+	for len(body)%4 != 0 {
+		body = append(body, 0)
+	}
+	total := uint32(12 + len(body))
+	b := append(le32(typ, total), body...)
+	return append(b, le32(total)...)
+}
+
+func sectionHeader() []byte {
+	// byte order magic, version 1.0 and an unknown section length
+	return block(blockSectionHeader, append(le32(byteOrderMagic, 0x00000001), le32(0xffffffff, 0xffffffff)...))
+}
+
+func interfaceDescription(opts []byte) []byte {
+	return block(blockInterfaceDescription, append(le32(1, 65535), opts...))
+}
+
+func enhancedPacket(ts uint64, data []byte) []byte {
+	body := le32(0, uint32(ts>>32), uint32(ts), uint32(len(data)), uint32(len(data)))
+	return block(blockEnhancedPacket, append(body, data...))
+}
+
+func concat(bs ...[]byte) []byte {
+	return bytes.Join(bs, nil)
+}
+
+func readAll(t *testing.T, b []byte) ([]*Packet, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "capture")
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var ps []*Packet
+	for {
+		p, err := r.Next()
+		if err == io.EOF {
+			return ps, nil
+		}
+		if err != nil {
+			return ps, err
+		}
+		ps = append(ps, p)
+	}
+}
+
+func TestReader(t *testing.T) {
+	payload := []byte{1, 2, 3, 4, 5}
+	tests := []struct {
+		name    string
+		file    []byte
+		packets int
+		err     string
+	}{
+		{
+			name:    "pcap",
+			file:    concat(pcapHeader(magicMicroseconds, 65535), pcapPacket(1, 500, payload), pcapPacket(2, 0, payload)),
+			packets: 2,
+		},
+		{
+			name: "empty file",
+			file: nil,
+			err:  "EOF",
+		},
+		{
+			name: "unknown magic",
+			file: concat(le32(0xdeadbeef), make([]byte, 20)),
+			err:  "not a pcap or pcapng file",
+		},
+		{
+			name: "truncated pcap header",
+			file: pcapHeader(magicMicroseconds, 65535)[:20],
+			err:  "unexpected EOF",
+		},
+		{
+			name:    "truncated packet header",
+			file:    concat(pcapHeader(magicMicroseconds, 65535), pcapPacket(1, 0, payload)[:10]),
+			packets: 0,
+			err:     "truncated packet header",
+		},
+		{
+			name:    "truncated packet",
+			file:    concat(pcapHeader(magicMicroseconds, 65535), pcapPacket(1, 0, payload)[:18]),
+			packets: 0,
+			err:     "truncated packet",
+		},
+		{
+			name: "corrupt packet length",
+			file: concat(pcapHeader(magicMicroseconds, 65535), le32(1, 0, 0xfffffff0, 0xfffffff0)),
+			err:  "invalid captured packet length",
+		},
+		{
+			name: "corrupt snap length",
+			file: concat(pcapHeader(magicMicroseconds, 0xffffffff), le32(1, 0, 0xfffffff0, 0xfffffff0)),
+			err:  "invalid captured packet length",
+		},
+		{
+			name:    "pcapng",
+			file:    concat(sectionHeader(), interfaceDescription(nil), enhancedPacket(1000000, payload)),
+			packets: 1,
+		},
+		{
+			name: "truncated section header",
+			file: sectionHeader()[:10],
+			err:  "truncated section header block",
+		},
+		{
+			name: "section header shorter than its fields",
+			file: concat(le32(blockSectionHeader, 8, byteOrderMagic)),
+			err:  "invalid section header block length 8",
+		},
+		{
+			name: "huge section header",
+			file: concat(le32(blockSectionHeader, 0xfffffff0, byteOrderMagic)),
+			err:  "invalid section header block length",
+		},
+		{
+			name: "invalid byte order magic",
+			file: concat(le32(blockSectionHeader, 28, 0x12345678)),
+			err:  "invalid byte order magic",
+		},
+		{
+			name: "block shorter than its header",
+			file: concat(sectionHeader(), le32(blockEnhancedPacket, 8)),
+			err:  "invalid block length 8",
+		},
+		{
+			name: "unaligned block length",
+			file: concat(sectionHeader(), le32(blockEnhancedPacket, 14)),
+			err:  "invalid block length 14",
+		},
+		{
+			name: "huge block",
+			file: concat(sectionHeader(), le32(blockEnhancedPacket, 0xfffffff0)),
+			err:  "invalid block length",
+		},
+		{
+			name: "truncated block",
+			file: concat(sectionHeader(), interfaceDescription(nil)[:12]),
+			err:  "truncated block",
+		},
+		{
+			name: "truncated interface description",
+			file: concat(sectionHeader(), block(blockInterfaceDescription, le32(1))),
+			err:  "truncated interface description block",
+		},
+		{
+			name: "truncated enhanced packet",
+			file: concat(sectionHeader(), interfaceDescription(nil), block(blockEnhancedPacket, le32(0, 0, 0))),
+			err:  "truncated enhanced packet block",
+		},
+		{
+			name: "captured length beyond the block",
+			file: concat(sectionHeader(), interfaceDescription(nil),
+				block(blockEnhancedPacket, le32(0, 0, 0, 100, 100))),
+			err: "truncated enhanced packet block",
+		},
+		{
+			name: "packet of undefined interface",
+			file: concat(sectionHeader(), enhancedPacket(0, payload)),
+			err:  "packet of undefined interface 0",
+		},
+		{
+			name: "option without padding",
+			// an if_tsresol option of 1 byte whose padding is cut off by the end of the block
+			file: concat(sectionHeader(),
+				block(blockInterfaceDescription, append(le32(1, 65535), 9, 0, 1, 0, 6)),
+				enhancedPacket(1000000, payload)),
+			packets: 1,
+		},
+		{
+			name: "option longer than the block",
+			file: concat(sectionHeader(),
+				block(blockInterfaceDescription, append(le32(1, 65535), 9, 0, 0xff, 0)),
+				enhancedPacket(1000000, payload)),
+			packets: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps, err := readAll(t, tt.file)
+			if tt.err == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("error %v, expected %q", err, tt.err)
+			}
+			if len(ps) != tt.packets {
+				t.Errorf("%d packets, expected %d", len(ps), tt.packets)
+			}
+		})
+	}
+}
+
+func TestResolution(t *testing.T) {
+	tests := []struct {
+		name    string
+		tsresol []byte
+		ts      uint64
+		want    time.Time
+	}{
+		{"default microseconds", nil, 1500000, time.Unix(1, 500000000)},
+		{"nanoseconds", []byte{9, 0, 1, 0, 9, 0, 0, 0}, 1500000000, time.Unix(1, 500000000)},
+		{"power of two", []byte{9, 0, 1, 0, 0x81, 0, 0, 0}, 3, time.Unix(1, 500000000)},
+		{"too fine power of ten", []byte{9, 0, 1, 0, 20, 0, 0, 0}, 1500000, time.Unix(1, 500000000)},
+		{"too fine power of two", []byte{9, 0, 1, 0, 0xff, 0, 0, 0}, 1500000, time.Unix(1, 500000000)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps, err := readAll(t, concat(sectionHeader(), interfaceDescription(tt.tsresol), enhancedPacket(tt.ts, []byte{1})))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ps) != 1 {
+				t.Fatalf("%d packets, expected 1", len(ps))
+			}
+			if !ps[0].Timestamp.Equal(tt.want) {
+				t.Errorf("timestamp %v, expected %v", ps[0].Timestamp, tt.want)
+			}
+		})
+	}
+}
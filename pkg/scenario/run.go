@@ -0,0 +1,193 @@
+package scenario
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chez-shanpu/traffic-generator/pkg/file"
+	"github.com/chez-shanpu/traffic-generator/pkg/iperf3"
+	"github.com/chez-shanpu/traffic-generator/pkg/option"
+	"github.com/chez-shanpu/traffic-generator/pkg/traffic"
+)
+
+// Execute validates the plans of every stage before running the stages one after another and the runs
+// of a stage concurrently. The results of every run are tagged with its phase and repeat, and returned
+// in the order of the stages together with the cycles which they ran. When ctx is done the running phases
+// are interrupted, and the results so far are returned with ctx.Err().
+func Execute(ctx context.Context, stages []Stage) (traffic.Results, traffic.Params, error) {
+	clients := make([][]*iperf3.Client, len(stages))
+	for i, stage := range stages {
+		for _, run := range stage.Runs {
+			c, err := iperf3.NewIperfClientFromParams(run.Config, run.Params)
+			if err != nil {
+				return nil, nil, fmt.Errorf("phase %q: %w", run.Phase, err)
+			}
+			clients[i] = append(clients[i], c)
+		}
+		if err := checkServers(stage, clients[i]); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var rs traffic.Results
+	var ps traffic.Params
+	for si, stage := range stages {
+		srs := make([]traffic.Results, len(stage.Runs))
+		sps := make([]traffic.Params, len(stage.Runs))
+		errs := make([]error, len(stage.Runs))
+
+		var wg sync.WaitGroup
+		for i, run := range stage.Runs {
+			wg.Add(1)
+			go func(i int, run Run) {
+				defer wg.Done()
+				fmt.Printf("Phase %s: repeat %d, %d cycles\n", run.Phase, run.Repeat, len(run.Params))
+				c := clients[si][i]
+				res, err := c.GenerateTraffic(ctx)
+				if err != nil && ctx.Err() == nil {
+					errs[i] = fmt.Errorf("phase %q: %w", run.Phase, err)
+					return
+				}
+				// cycles which did not start before an interruption have no results
+				for j, r := range res {
+					if r == nil {
+						continue
+					}
+					r.Phase = run.Phase
+					r.Repeat = run.Repeat
+					srs[i] = append(srs[i], r)
+					sps[i] = append(sps[i], c.Params[j])
+				}
+			}(i, run)
+		}
+		wg.Wait()
+
+		if err := ctx.Err(); err != nil {
+			for i := range stage.Runs {
+				rs = append(rs, srs[i]...)
+				ps = append(ps, sps[i]...)
+			}
+			return rs, ps, err
+		}
+		for _, err := range errs {
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		for i := range stage.Runs {
+			rs = append(rs, srs[i]...)
+			ps = append(ps, sps[i]...)
+		}
+
+		if stage.Pause > 0 {
+			fmt.Printf("Pause %d msec\n", stage.Pause.Milliseconds())
+			select {
+			case <-time.After(stage.Pause):
+			case <-ctx.Done():
+				return rs, ps, ctx.Err()
+			}
+		}
+	}
+	return rs, ps, nil
+}
+
+// checkServers checks that the runs of a stage, which run concurrently, are not sent to the same iperf3
+// server, which serves a single test at a time.
+func checkServers(stage Stage, cs []*iperf3.Client) error {
+	owner := map[string]int{}
+	for i, c := range cs {
+		for _, s := range c.Servers() {
+			if j, ok := owner[s]; ok && j != i {
+				return fmt.Errorf("parallel phases %q and %q are both sent to %s, give them different %s or %s settings",
+					stage.Runs[j].Phase, stage.Runs[i].Phase, s, option.DstPort, option.Ports)
+			}
+			owner[s] = i
+		}
+	}
+	return nil
+}
+
+// OutputResults writes the results of every cycle followed by the totals of every phase and of the scenario.
+func OutputResults(rs traffic.Results, ps traffic.Params, out string) error {
+	f, err := file.Create(out)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	defer w.Flush()
+
+	head := []string{"Phase", "Repeat", "Cycle", "Flow", "SendByte", "Bitrate", "SendSecond", "WaitMilliSecond", "PlannedStartSecond", "StartSecond", "Status", "Error"}
+	if err := w.Write(head); err != nil {
+		return err
+	}
+
+	var phases []string
+	byPhase := map[string][]int{}
+	for i, r := range rs {
+		if _, ok := byPhase[r.Phase]; !ok {
+			phases = append(phases, r.Phase)
+		}
+		byPhase[r.Phase] = append(byPhase[r.Phase], i)
+
+		line := []string{
+			r.Phase,
+			strconv.Itoa(r.Repeat),
+			strconv.Itoa(r.Cycle),
+			strconv.Itoa(r.Flow),
+			strconv.FormatInt(r.SendByte, 10),
+			ps[i].Bitrate.String(),
+			strconv.FormatFloat(r.SendSecond, 'f', -1, 64),
+			strconv.FormatInt(int64(ps[i].WaitMilliSeconds), 10),
+			strconv.FormatFloat(r.PlannedStartSecond, 'f', 3, 64),
+			"",
+			r.Status,
+			r.Error,
+		}
+		if r.Started() {
+			line[9] = strconv.FormatFloat(r.StartSecond, 'f', 3, 64)
+		}
+		if err := w.Write(line); err != nil {
+			return err
+		}
+	}
+
+	for _, ph := range phases {
+		var prs traffic.Results
+		var pps traffic.Params
+		for _, i := range byPhase[ph] {
+			prs = append(prs, rs[i])
+			pps = append(pps, ps[i])
+		}
+		if err := w.Write(totalLine(ph, prs, pps)); err != nil {
+			return err
+		}
+	}
+	return w.Write(totalLine("-", rs, ps))
+}
+
+func totalLine(phase string, rs traffic.Results, ps traffic.Params) []string {
+	var send traffic.Second
+	var wait traffic.MilliSecond
+	for _, p := range ps {
+		send += p.SendSeconds
+		wait += p.WaitMilliSeconds
+	}
+	return []string{
+		"Total",
+		phase,
+		"-",
+		"-",
+		strconv.FormatInt(rs.TotalSendBytes(), 10),
+		"-",
+		strconv.FormatInt(int64(send), 10),
+		strconv.FormatFloat(float64(wait), 'f', -1, 64),
+		"-",
+		"-",
+		"-",
+		"-",
+	}
+}
@@ -0,0 +1,256 @@
+package scenario
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/chez-shanpu/traffic-generator/pkg/option"
+	"github.com/chez-shanpu/traffic-generator/pkg/sts"
+	"github.com/chez-shanpu/traffic-generator/pkg/traffic"
+	"gopkg.in/yaml.v2"
+)
+
+// Scenario is a sequence of traffic phases, e.g.
+//
+//	defaults:
+//	  send-dist: exponential:rate=0.5
+//	phases:
+//	- name: warmup
+//	  params: warmup.csv
+//	  transition:
+//	    pause: 10s
+//	- name: ramp
+//	  settings: {cycle: 10, bitrate: 10M}
+//	  repeat: 3
+//	- parallel:
+//	  - name: bulk
+//	    settings: {cycle: 50, bitrate: 100M, dst-port: 5201}
+//	  - name: voip
+//	    settings: {cycle: 50, workload: synth-voip, dst-port: 5202}
+type Scenario struct {
+	Name string `yaml:"name"`
+	// Defaults are the settings shared by every phase.
+	Defaults map[string]interface{} `yaml:"defaults"`
+	Steps    []Step                 `yaml:"phases"`
+
+	dir string
+}
+
+// Step is a phase, or a group of phases run in parallel whose settings, repeat and transition
+// apply to every phase of the group.
+type Step struct {
+	Phase    `yaml:",inline"`
+	Parallel []Phase `yaml:"parallel"`
+}
+
+// Phase is a params file, or planner settings whose keys are the flag names of tg init and tg run.
+type Phase struct {
+	Name       string                 `yaml:"name"`
+	Params     string                 `yaml:"params"`
+	Settings   map[string]interface{} `yaml:"settings"`
+	Repeat     int                    `yaml:"repeat"`
+	Transition Transition             `yaml:"transition"`
+}
+
+// Transition is how the scenario moves on to the next step.
+type Transition struct {
+	// Pause is the idle time after the step (e.g. 30s).
+	Pause string `yaml:"pause"`
+}
+
+// Run is a repeat of a phase expanded into its cycles.
+type Run struct {
+	Phase  string
+	Repeat int
+	Config option.Config
+	Params traffic.Params
+}
+
+// Stage is the runs of a step started together, followed by a pause.
+type Stage struct {
+	Runs  []Run
+	Pause time.Duration
+}
+
+// Load reads a scenario file. Params files of phases are relative to the directory of the scenario file.
+func Load(path string) (*Scenario, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &Scenario{}
+	if err := yaml.UnmarshalStrict(b, s); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	s.dir = filepath.Dir(path)
+	if err := s.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+func (s *Scenario) validate() error {
+	if len(s.Steps) == 0 {
+		return fmt.Errorf("the scenario has no phases")
+	}
+	names := map[string]bool{}
+	for i, st := range s.Steps {
+		if st.Repeat < 0 {
+			return fmt.Errorf("phase %d: repeat must not be negative", i)
+		}
+		if _, err := st.pause(); err != nil {
+			return fmt.Errorf("phase %d: %w", i, err)
+		}
+		if len(st.Parallel) > 0 {
+			if st.Params != "" {
+				return fmt.Errorf("phase %d: a parallel group cannot have params", i)
+			}
+		} else if st.Params == "" && st.Settings == nil {
+			return fmt.Errorf("phase %d: params or settings are required", i)
+		}
+
+		for _, ph := range st.phases() {
+			if ph.Name == "" {
+				return fmt.Errorf("phase %d: name is required", i)
+			}
+			if names[ph.Name] {
+				return fmt.Errorf("phase %q is defined twice", ph.Name)
+			}
+			names[ph.Name] = true
+			if len(st.Parallel) == 0 {
+				continue
+			}
+			if ph.Params != "" && ph.Settings != nil {
+				return fmt.Errorf("phase %q: params and settings are exclusive", ph.Name)
+			}
+			if ph.Params == "" && ph.Settings == nil && st.Settings == nil {
+				return fmt.Errorf("phase %q: params or settings are required", ph.Name)
+			}
+			if ph.Repeat != 0 || ph.Transition.Pause != "" {
+				return fmt.Errorf("phase %q: repeat and transition of parallel phases are given by their group", ph.Name)
+			}
+		}
+		if len(st.Parallel) == 0 && st.Params != "" && st.Settings != nil {
+			return fmt.Errorf("phase %q: params and settings are exclusive", st.Name)
+		}
+	}
+	return nil
+}
+
+// phases returns the phases run by the step.
+func (st Step) phases() []Phase {
+	if len(st.Parallel) > 0 {
+		return st.Parallel
+	}
+	return []Phase{st.Phase}
+}
+
+func (st Step) repeat() int {
+	if st.Repeat == 0 {
+		return 1
+	}
+	return st.Repeat
+}
+
+func (st Step) pause() (time.Duration, error) {
+	if st.Transition.Pause == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(st.Transition.Pause)
+	if err != nil {
+		return 0, fmt.Errorf("invalid pause: %w", err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("pause must not be negative")
+	}
+	return d, nil
+}
+
+// Expand generates the cycles of every repeat of every phase. Settings override the global configuration
+// in the order of the defaults, the settings of a parallel group and the settings of the phase. Every
+// planner run draws its own random streams from the seed.
+func (s *Scenario) Expand() ([]Stage, error) {
+	var stages []Stage
+	var n uint64
+	for _, st := range s.Steps {
+		pause, _ := st.pause()
+		for r := 0; r < st.repeat(); r++ {
+			stage := Stage{}
+			for _, ph := range st.phases() {
+				cfg, err := option.Override(merge(s.Defaults, st.settings(), ph.Settings))
+				if err != nil {
+					return nil, fmt.Errorf("phase %q: %w", ph.Name, err)
+				}
+
+				var ps traffic.Params
+				if ph.Params != "" {
+					ps, err = s.load(ph.Params)
+				} else {
+					cfg.Seed += n
+					n++
+					ps, err = generate(cfg)
+				}
+				if err != nil {
+					return nil, fmt.Errorf("phase %q: %w", ph.Name, err)
+				}
+				stage.Runs = append(stage.Runs, Run{Phase: ph.Name, Repeat: r, Config: cfg, Params: ps})
+			}
+			if r == st.repeat()-1 {
+				stage.Pause = pause
+			}
+			stages = append(stages, stage)
+		}
+	}
+	return stages, nil
+}
+
+// settings returns the settings shared by the phases of a parallel group.
+func (st Step) settings() map[string]interface{} {
+	if len(st.Parallel) > 0 {
+		return st.Settings
+	}
+	return nil
+}
+
+func (s *Scenario) load(path string) (traffic.Params, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(s.dir, path)
+	}
+	p, err := traffic.LoadPlan(path)
+	if err != nil {
+		return nil, err
+	}
+	return p.Cycles, nil
+}
+
+func generate(cfg option.Config) (traffic.Params, error) {
+	n := cfg.Flows
+	if n < 1 {
+		n = 1
+	}
+	cfgs := make([]option.Config, n)
+	for i := range cfgs {
+		cfgs[i] = cfg
+	}
+	planners, err := sts.NewFlowPlanners(cfgs)
+	if err != nil {
+		return nil, err
+	}
+	fs, err := sts.GenerateFlows(planners)
+	if err != nil {
+		return nil, err
+	}
+	return sts.MergeFlows(planners, fs), nil
+}
+
+func merge(ms ...map[string]interface{}) map[string]interface{} {
+	res := map[string]interface{}{}
+	for _, m := range ms {
+		for k, v := range m {
+			res[k] = v
+		}
+	}
+	return res
+}
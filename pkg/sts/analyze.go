@@ -0,0 +1,224 @@
+package sts
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"gonum.org/v1/gonum/stat"
+)
+
+// Summary holds the summary statistics of samples.
+type Summary struct {
+	Count  int     `json:"count"`
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"stddev"`
+	Min    float64 `json:"min"`
+	P25    float64 `json:"p25"`
+	Median float64 `json:"median"`
+	P75    float64 `json:"p75"`
+	P95    float64 `json:"p95"`
+	P99    float64 `json:"p99"`
+	Max    float64 `json:"max"`
+}
+
+// ECDFPoint is a point of an empirical CDF.
+type ECDFPoint struct {
+	Value float64 `json:"value"`
+	Prob  float64 `json:"prob"`
+}
+
+// QuantilePoint is a quantile of the empirical CDF and, if the parameter has a distribution, the
+// quantile of the distribution at the same probability.
+type QuantilePoint struct {
+	Prob     float64  `json:"prob"`
+	Value    float64  `json:"value"`
+	Expected *float64 `json:"expected,omitempty"`
+}
+
+// quantileProbs are the probabilities of the quantile table of analyses.
+var quantileProbs = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 0.75, 0.9, 0.95, 0.99}
+
+// TestResult is the statistic and p-value of a goodness-of-fit test.
+type TestResult struct {
+	Statistic float64 `json:"statistic"`
+	PValue    float64 `json:"p_value"`
+}
+
+// Analysis is the goodness-of-fit of one parameter of a plan to its distribution.
+type Analysis struct {
+	Param        string      `json:"param"`
+	Distribution string      `json:"distribution,omitempty"`
+	Summary      Summary     `json:"summary"`
+	ECDF         []ECDFPoint `json:"ecdf"`
+	// Quantiles compares the empirical CDF with the distribution at quantileProbs.
+	Quantiles []QuantilePoint `json:"quantiles,omitempty"`
+	KS        *TestResult     `json:"kolmogorov_smirnov,omitempty"`
+	AD        *TestResult     `json:"anderson_darling,omitempty"`
+}
+
+// Analyze computes the summary statistics and empirical CDF of xs and, if d is not nil,
+// tests them against d with the Kolmogorov-Smirnov and Anderson-Darling tests.
+func Analyze(param string, xs []float64, spec string, d Distribution) Analysis {
+	s := append([]float64(nil), xs...)
+	sort.Float64s(s)
+
+	a := Analysis{
+		Param:   param,
+		Summary: summarize(s),
+		ECDF:    ecdf(s),
+	}
+	if len(s) == 0 {
+		return a
+	}
+	for _, p := range quantileProbs {
+		q := QuantilePoint{Prob: p, Value: ecdfQuantile(a.ECDF, p)}
+		if d != nil {
+			e := d.Quantile(p)
+			q.Expected = &e
+		}
+		a.Quantiles = append(a.Quantiles, q)
+	}
+	if d == nil {
+		return a
+	}
+
+	a.Distribution = spec
+	ks := KolmogorovSmirnov(s, d)
+	a.KS = &TestResult{Statistic: ks, PValue: KolmogorovSmirnovPValue(ks, len(s))}
+	ad := AndersonDarling(s, d)
+	a.AD = &TestResult{Statistic: ad, PValue: AndersonDarlingPValue(ad)}
+	return a
+}
+
+// AnalyzePlan analyzes the bitrates, send and wait seconds of a plan. Parameters which the planner
+// draws from a single distribution, which only the renewal model does, are tested against it.
+func (p Planner) AnalyzePlan(s *Samples) []Analysis {
+	renewal := p.Model == "" || p.Model == ModelRenewal
+
+	bitrates := make([]float64, len(s.Bitrates))
+	for i, b := range s.Bitrates {
+		bitrates[i] = b / float64(p.BitrateUnit)
+	}
+
+	var bd, sd, wd Distribution
+	if renewal && p.Bitrate == 0 {
+		bd = p.BitrateDist
+	}
+	if renewal && p.SendSeconds <= 0 {
+		sd = ceiled{p.SendDist}
+	}
+	if renewal && p.WaitSeconds <= 0 {
+		wd = p.WaitDist
+	}
+
+	return []Analysis{
+		Analyze("bitrate", bitrates, p.specs[bitrateStream], bd),
+		Analyze("send", s.SendSeconds, p.specs[sendStream], sd),
+		Analyze("wait", s.WaitSeconds, p.specs[waitStream], wd),
+	}
+}
+
+func summarize(sorted []float64) Summary {
+	if len(sorted) == 0 {
+		return Summary{}
+	}
+	mean, sd := stat.MeanStdDev(sorted, nil)
+	q := func(p float64) float64 {
+		return stat.Quantile(p, stat.Empirical, sorted, nil)
+	}
+	return Summary{
+		Count:  len(sorted),
+		Mean:   mean,
+		StdDev: sd,
+		Min:    sorted[0],
+		P25:    q(0.25),
+		Median: q(0.5),
+		P75:    q(0.75),
+		P95:    q(0.95),
+		P99:    q(0.99),
+		Max:    sorted[len(sorted)-1],
+	}
+}
+
+func ecdf(sorted []float64) []ECDFPoint {
+	var ps []ECDFPoint
+	n := float64(len(sorted))
+	for i, x := range sorted {
+		if i+1 < len(sorted) && sorted[i+1] == x {
+			continue
+		}
+		ps = append(ps, ECDFPoint{Value: x, Prob: float64(i+1) / n})
+	}
+	return ps
+}
+
+// ecdfQuantile returns the smallest value of the empirical CDF whose probability is at least p.
+func ecdfQuantile(ps []ECDFPoint, p float64) float64 {
+	i := sort.Search(len(ps), func(i int) bool { return ps[i].Prob >= p })
+	if i == len(ps) {
+		i = len(ps) - 1
+	}
+	return ps[i].Value
+}
+
+// writeQuantiles writes the quantile table of an analysis, with the quantiles of its distribution if it has one.
+func writeQuantiles(w io.Writer, a Analysis) error {
+	if len(a.Quantiles) == 0 {
+		return nil
+	}
+	head := "  prob    plan"
+	if a.Distribution != "" {
+		head += "          distribution"
+	}
+	if _, err := fmt.Fprintln(w, head); err != nil {
+		return err
+	}
+	for _, q := range a.Quantiles {
+		line := fmt.Sprintf("  %-7g %-13.6g", q.Prob, q.Value)
+		if q.Expected != nil {
+			line += fmt.Sprintf(" %.6g", *q.Expected)
+		}
+		if _, err := fmt.Fprintln(w, strings.TrimRight(line, " ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteText writes the analyses as a human readable report.
+func WriteText(w io.Writer, as []Analysis) error {
+	for _, a := range as {
+		s := a.Summary
+		if _, err := fmt.Fprintf(w, "%s\n", a.Param); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "  count %d  mean %g  stddev %g\n", s.Count, s.Mean, s.StdDev); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "  min %g  p25 %g  median %g  p75 %g  p95 %g  p99 %g  max %g\n",
+			s.Min, s.P25, s.Median, s.P75, s.P95, s.P99, s.Max); err != nil {
+			return err
+		}
+		if err := writeQuantiles(w, a); err != nil {
+			return err
+		}
+		if a.Distribution == "" {
+			if _, err := fmt.Fprintf(w, "  no distribution to test against\n"); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "  distribution %s\n", a.Distribution); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "  Kolmogorov-Smirnov  D = %.4f  p = %.4f\n", a.KS.Statistic, a.KS.PValue); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "  Anderson-Darling    A2 = %.4f  p = %.4f\n", a.AD.Statistic, a.AD.PValue); err != nil {
+			return err
+		}
+	}
+	return nil
+}
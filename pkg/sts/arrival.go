@@ -0,0 +1,40 @@
+package sts
+
+import (
+	"github.com/chez-shanpu/traffic-generator/pkg/traffic"
+)
+
+// GenerateArrivalParams generates CycleNum flows of a single cycle each, arriving as a renewal process
+// whose inter-arrival times are drawn from ArrivalDist. Flows start at their arrival regardless of the
+// flows before them, so they may overlap. If the planner has an envelope, the bitrate of each flow is
+// multiplied and the inter-arrival time before the next one divided by the envelope at its arrival.
+func (p *Planner) GenerateArrivalParams() traffic.Params {
+	bits := p.GenerateBitrates()
+	sends := p.GenerateSendSeconds()
+	gaps := p.uniforms(arrivalStream, p.CycleNum)
+
+	ts := make(traffic.Params, p.CycleNum)
+	for i := range ts {
+		ts[i] = &traffic.Param{
+			Bitrate:     bits[i],
+			SendSeconds: sends[i],
+		}
+	}
+	p.sizes(ts)
+
+	var start traffic.MilliSecond
+	for i, t := range ts {
+		t.StartMilliSeconds = start
+		gap := float64(waitMilliSeconds(p.ArrivalDist, gaps[i]))
+		if p.Envelope != nil {
+			m := p.Envelope.Multiplier(p.hourOfDay(start))
+			t.Bitrate = (t.Bitrate * traffic.Bitrate(m)).Clamp(p.BitrateMin, p.BitrateMax)
+			if t.FlowBytes > 0 {
+				t.SetFlowBytes(t.FlowBytes)
+			}
+			gap /= m
+		}
+		start += traffic.MilliSecond(gap)
+	}
+	return ts
+}
@@ -0,0 +1,243 @@
+package sts
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/chez-shanpu/traffic-generator/pkg/traffic"
+)
+
+const (
+	ConstraintTruncate = "truncate"
+	ConstraintReject   = "reject"
+	ConstraintRescale  = "rescale"
+)
+
+// maxRejections is the number of plans drawn by the reject method before it gives up.
+const maxRejections = 1000
+
+// Constraints restricts the cycles and the totals of a plan.
+//
+// Cycles whose send seconds are out of [SendMin, SendMax] are clamped by the truncate and rescale methods
+// and redrawn by the reject method. The totals are enforced as follows:
+//
+//	truncate  drops the cycles after MaxDuration and shortens the plan once TargetBytes is sent
+//	reject    redraws the whole plan until it fits MaxDuration and TargetBytes within Tolerance
+//	rescale   scales the durations to fit MaxDuration and then the bitrates to send TargetBytes within Tolerance
+type Constraints struct {
+	Method      string
+	MaxDuration traffic.MilliSecond
+	TargetBytes int64
+	Tolerance   float64
+	SendMin     traffic.Second
+	SendMax     traffic.Second
+}
+
+func (c Constraints) validate() error {
+	switch c.Method {
+	case ConstraintTruncate, ConstraintReject, ConstraintRescale:
+	default:
+		return fmt.Errorf("unknown constraint method %q (available: %s, %s, %s)", c.Method, ConstraintTruncate, ConstraintReject, ConstraintRescale)
+	}
+	if c.MaxDuration < 0 || c.TargetBytes < 0 || c.SendMin < 0 || c.SendMax < 0 {
+		return fmt.Errorf("constraints must not be negative")
+	}
+	if c.SendMax > 0 && c.SendMax < c.SendMin {
+		return fmt.Errorf("maximum send seconds %d is less than minimum send seconds %d", c.SendMax, c.SendMin)
+	}
+	if c.Tolerance < 0 {
+		return fmt.Errorf("target tolerance %v must not be negative", c.Tolerance)
+	}
+	return nil
+}
+
+func (c Constraints) hasTotals() bool {
+	return c.MaxDuration > 0 || c.TargetBytes > 0
+}
+
+func (c Constraints) satisfied(ts traffic.Params) bool {
+	if c.MaxDuration > 0 && ts.Duration() > c.MaxDuration {
+		return false
+	}
+	if c.TargetBytes > 0 && math.Abs(float64(ts.TotalBytes()-c.TargetBytes)) > c.Tolerance*float64(c.TargetBytes) {
+		return false
+	}
+	return true
+}
+
+func (c Constraints) clampSend(s traffic.Second) traffic.Second {
+	if s < c.SendMin {
+		return c.SendMin
+	}
+	if c.SendMax > 0 && s > c.SendMax {
+		return c.SendMax
+	}
+	return s
+}
+
+// apply enforces the totals on a scheduled plan with the truncate or rescale method.
+func (p Planner) applyConstraints(ts traffic.Params) (traffic.Params, error) {
+	c := p.Constraints
+	switch c.Method {
+	case ConstraintTruncate:
+		if c.TargetBytes > 0 {
+			ts = truncateBytes(ts, c.TargetBytes)
+		}
+		if c.MaxDuration > 0 {
+			ts = truncateDuration(ts, c.MaxDuration)
+		}
+	case ConstraintRescale:
+		// durations first, as shortening them cuts the bytes which the bitrates are then scaled to
+		if c.MaxDuration > 0 {
+			p.rescaleDuration(ts)
+		}
+		if c.TargetBytes > 0 {
+			p.rescaleBytes(ts)
+		}
+	}
+
+	// flows of the arrival model start at their arrival, not after the previous ones
+	if p.Model != ModelArrival {
+		if len(ts) > 0 {
+			ts[len(ts)-1].WaitMilliSeconds = 0
+		}
+		ts.Schedule()
+	}
+	if c.Method == ConstraintRescale && !c.satisfied(ts) {
+		return nil, fmt.Errorf("the plan of %d bytes in %s cannot be rescaled to the constraints within the bounds of bitrates and send seconds",
+			ts.TotalBytes(), time.Duration(ts.Duration())*time.Millisecond)
+	}
+	return ts, nil
+}
+
+// rescalePasses is the number of times rescaleDuration scales the plan, as send durations which are rounded
+// down to whole seconds of at least 1 shrink less than the rest of the plan.
+const rescalePasses = 10
+
+// rescaleDuration scales the send durations, waits and start offsets of the plan to fit MaxDuration.
+func (p Planner) rescaleDuration(ts traffic.Params) {
+	c := p.Constraints
+	for i := 0; i < rescalePasses; i++ {
+		d := ts.Duration()
+		if d <= c.MaxDuration {
+			return
+		}
+		f := float64(c.MaxDuration) / float64(d)
+		for _, t := range ts {
+			if t.FlowBytes > 0 {
+				// flows of a given size are shortened by sending them faster
+				t.Bitrate = (t.Bitrate / traffic.Bitrate(f)).Clamp(p.BitrateMin, p.BitrateMax)
+				t.SetFlowBytes(t.FlowBytes)
+			} else {
+				s := traffic.Second(math.Max(math.Floor(float64(t.SendSeconds)*f), 1))
+				t.SendSeconds = c.clampSend(s)
+			}
+			t.WaitMilliSeconds = traffic.MilliSecond(float64(t.WaitMilliSeconds) * f)
+			t.StartMilliSeconds = traffic.MilliSecond(float64(t.StartMilliSeconds) * f)
+		}
+		if p.Model != ModelArrival {
+			ts.Schedule()
+		}
+	}
+}
+
+// rescaleBytes scales the bitrates of the plan to send TargetBytes, keeping the durations of the cycles.
+func (p Planner) rescaleBytes(ts traffic.Params) {
+	total := ts.TotalBytes()
+	if total <= 0 {
+		return
+	}
+	f := float64(p.Constraints.TargetBytes) / float64(total)
+	for _, t := range ts {
+		t.Bitrate = (t.Bitrate * traffic.Bitrate(f)).Clamp(p.BitrateMin, p.BitrateMax)
+		if t.FlowBytes > 0 {
+			// the flow is sent at the scaled bitrate, so that it takes as long as before
+			t.FlowBytes = int64(math.Max(math.Round(float64(t.FlowBytes)*f), 1))
+		}
+	}
+}
+
+func truncateBytes(ts traffic.Params, target int64) traffic.Params {
+	var total int64
+	for i, t := range ts {
+		b := t.Bytes()
+		if total+b < target {
+			total += b
+			continue
+		}
+		if t.FlowBytes > 0 {
+			t.SetFlowBytes(target - total)
+		} else if t.Bitrate > 0 {
+			t.SendSeconds = traffic.Second(math.Ceil(float64(target-total) * 8 / float64(t.Bitrate)))
+		}
+		return ts[:i+1]
+	}
+	return ts
+}
+
+// truncateDuration drops the cycles which end after max.
+func truncateDuration(ts traffic.Params, max traffic.MilliSecond) traffic.Params {
+	var res traffic.Params
+	for _, t := range ts {
+		if t.StartMilliSeconds+traffic.MilliSecond(t.SendSeconds)*1000 <= max {
+			res = append(res, t)
+		}
+	}
+	return res
+}
+
+// Deviation is the distance between the generated values of a parameter and its requested distribution.
+type Deviation struct {
+	Param string
+	KS    float64
+}
+
+// Deviations returns the Kolmogorov-Smirnov distance between the random parameters of the plan and their distributions.
+// Only the renewal and arrival models draw every cycle from a single distribution, so other models have no deviations.
+func (p Planner) Deviations(ts traffic.Params) []Deviation {
+	if p.Model != "" && p.Model != ModelRenewal && p.Model != ModelArrival || len(ts) == 0 {
+		return nil
+	}
+
+	var ds []Deviation
+	if p.Bitrate == 0 {
+		var xs []float64
+		for _, t := range ts {
+			xs = append(xs, float64(t.Bitrate/p.BitrateUnit))
+		}
+		ds = append(ds, Deviation{Param: "bitrate", KS: KolmogorovSmirnov(xs, p.BitrateDist)})
+	}
+	if p.SendSeconds <= 0 && p.SizeDist == nil {
+		var xs []float64
+		for _, t := range ts {
+			xs = append(xs, float64(t.SendSeconds))
+		}
+		ds = append(ds, Deviation{Param: "send", KS: KolmogorovSmirnov(xs, ceiled{p.SendDist})})
+	}
+	if p.SizeDist != nil {
+		var xs []float64
+		for _, t := range ts {
+			xs = append(xs, float64(t.FlowBytes))
+		}
+		ds = append(ds, Deviation{Param: "size", KS: KolmogorovSmirnov(xs, ceiled{p.SizeDist})})
+	}
+	if p.Model == ModelArrival {
+		if len(ts) > 1 {
+			var xs []float64
+			for i := 1; i < len(ts); i++ {
+				xs = append(xs, float64(ts[i].StartMilliSeconds-ts[i-1].StartMilliSeconds)/1000)
+			}
+			ds = append(ds, Deviation{Param: "arrival", KS: KolmogorovSmirnov(xs, p.ArrivalDist)})
+		}
+		return ds
+	}
+	if p.WaitSeconds <= 0 && len(ts) > 1 {
+		var xs []float64
+		for _, t := range ts[:len(ts)-1] {
+			xs = append(xs, float64(t.WaitMilliSeconds)/1000)
+		}
+		ds = append(ds, Deviation{Param: "wait", KS: KolmogorovSmirnov(xs, p.WaitDist)})
+	}
+	return ds
+}
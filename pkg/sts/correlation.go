@@ -0,0 +1,72 @@
+package sts
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Correlation is a Gaussian copula which couples the bitrate, send and wait streams.
+type Correlation struct {
+	lower *mat.TriDense
+}
+
+// ParseCorrelation parses a correlation model such as "bitrate:send=0.5,send:wait=-0.3".
+// Pairs which are not specified are uncorrelated. An empty string returns nil.
+func ParseCorrelation(s string) (*Correlation, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	m := mat.NewSymDense(correlatedStreams, nil)
+	for i := 0; i < correlatedStreams; i++ {
+		m.SetSym(i, i, 1)
+	}
+
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid correlation %q: expected <stream>:<stream>=<coefficient>", pair)
+		}
+		names := strings.SplitN(kv[0], ":", 2)
+		if len(names) != 2 {
+			return nil, fmt.Errorf("invalid correlation %q: expected <stream>:<stream>=<coefficient>", pair)
+		}
+		a, ok := streamNames[strings.TrimSpace(names[0])]
+		if !ok || int(a) >= correlatedStreams {
+			return nil, fmt.Errorf("unknown stream %q in correlation", names[0])
+		}
+		b, ok := streamNames[strings.TrimSpace(names[1])]
+		if !ok || int(b) >= correlatedStreams {
+			return nil, fmt.Errorf("unknown stream %q in correlation", names[1])
+		}
+		if a == b {
+			return nil, fmt.Errorf("stream %q cannot be correlated with itself", names[0])
+		}
+		rho, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid correlation coefficient %q: %w", kv[1], err)
+		}
+		if rho <= -1 || rho >= 1 {
+			return nil, fmt.Errorf("correlation coefficient %v must be in (-1, 1)", rho)
+		}
+		m.SetSym(int(a), int(b), rho)
+	}
+
+	var chol mat.Cholesky
+	if ok := chol.Factorize(m); !ok {
+		return nil, fmt.Errorf("correlation matrix %q is not positive definite", s)
+	}
+	var l mat.TriDense
+	chol.LTo(&l)
+
+	return &Correlation{lower: &l}, nil
+}
+
+func (c *Correlation) couple(z []float64) []float64 {
+	x := mat.NewVecDense(len(z), nil)
+	x.MulVec(c.lower, mat.NewVecDense(len(z), z))
+	return x.RawVector().Data
+}
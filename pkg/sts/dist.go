@@ -0,0 +1,499 @@
+package sts
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gonum.org/v1/gonum/stat/distuv"
+)
+
+// Distribution is a univariate distribution which the planner samples through its quantile function.
+type Distribution interface {
+	CDF(x float64) float64
+	Quantile(p float64) float64
+}
+
+// DistFactory creates a distribution from its parameters.
+type DistFactory func(ps DistParams) (Distribution, error)
+
+var distributions = map[string]DistFactory{}
+
+// RegisterDistribution makes a distribution available by name to ParseDistSpec users.
+func RegisterDistribution(name string, f DistFactory) {
+	distributions[name] = f
+}
+
+// Distributions returns the names of the registered distributions.
+func Distributions() []string {
+	var names []string
+	for name := range distributions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	RegisterDistribution("constant", newConstant)
+	RegisterDistribution("empirical", newEmpirical)
+	RegisterDistribution("exponential", newExponential)
+	RegisterDistribution("gamma", newGamma)
+	RegisterDistribution("lognormal", newLogNormal)
+	RegisterDistribution("normal", newTruncatedNormal)
+	RegisterDistribution("pareto", newPareto)
+	RegisterDistribution("poisson", newPoisson)
+	RegisterDistribution("uniform", newUniform)
+	RegisterDistribution("weibull", newWeibull)
+}
+
+// DistSpec is a named distribution with its parameters, written as "<name>:<key>=<value>,...".
+type DistSpec struct {
+	Name   string
+	Params DistParams
+}
+
+// ParseDistSpec parses a distribution spec such as "pareto:xm=1,alpha=1.5".
+func ParseDistSpec(s string) (DistSpec, error) {
+	kv := strings.SplitN(strings.TrimSpace(s), ":", 2)
+	spec := DistSpec{
+		Name:   strings.ToLower(kv[0]),
+		Params: DistParams{},
+	}
+	if _, ok := distributions[spec.Name]; !ok {
+		return DistSpec{}, fmt.Errorf("unknown distribution %q (available: %s)", kv[0], strings.Join(Distributions(), ", "))
+	}
+	if len(kv) == 1 || kv[1] == "" {
+		return spec, nil
+	}
+
+	for _, param := range strings.Split(kv[1], ",") {
+		p := strings.SplitN(param, "=", 2)
+		if len(p) != 2 {
+			return DistSpec{}, fmt.Errorf("invalid parameter %q of distribution %s: expected <key>=<value>", param, spec.Name)
+		}
+		spec.Params[strings.TrimSpace(p[0])] = strings.TrimSpace(p[1])
+	}
+	return spec, nil
+}
+
+func (s DistSpec) String() string {
+	var keys []string
+	for k := range s.Params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var ps []string
+	for _, k := range keys {
+		ps = append(ps, k+"="+s.Params[k])
+	}
+	if len(ps) == 0 {
+		return s.Name
+	}
+	return s.Name + ":" + strings.Join(ps, ",")
+}
+
+// New creates the distribution described by the spec.
+func (s DistSpec) New() (Distribution, error) {
+	f, ok := distributions[s.Name]
+	if !ok {
+		return nil, fmt.Errorf("unknown distribution %q", s.Name)
+	}
+	d, err := f(s.Params)
+	if err != nil {
+		return nil, fmt.Errorf("distribution %s: %w", s, err)
+	}
+	return d, nil
+}
+
+// NewDistribution parses the spec and creates the distribution.
+func NewDistribution(spec string) (Distribution, error) {
+	s, err := ParseDistSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	return s.New()
+}
+
+// DistParams holds the raw parameters of a distribution spec.
+type DistParams map[string]string
+
+// Float returns the first of the given keys which is set as a float.
+func (ps DistParams) Float(keys ...string) (float64, error) {
+	for _, k := range keys {
+		v, ok := ps[k]
+		if !ok {
+			continue
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, fmt.Errorf("parameter %s: %w", k, err)
+		}
+		return f, nil
+	}
+	return 0, fmt.Errorf("parameter %s is required", keys[0])
+}
+
+// FloatOr is like Float but returns def if none of the keys is set.
+func (ps DistParams) FloatOr(def float64, keys ...string) (float64, error) {
+	for _, k := range keys {
+		if _, ok := ps[k]; ok {
+			return ps.Float(keys...)
+		}
+	}
+	return def, nil
+}
+
+func positive(name string, v float64) error {
+	if !(v > 0) {
+		return fmt.Errorf("parameter %s must be positive, got %v", name, v)
+	}
+	return nil
+}
+
+type constant float64
+
+func newConstant(ps DistParams) (Distribution, error) {
+	v, err := ps.Float("value", "v")
+	if err != nil {
+		return nil, err
+	}
+	return constant(v), nil
+}
+
+func (c constant) CDF(x float64) float64 {
+	if x < float64(c) {
+		return 0
+	}
+	return 1
+}
+
+func (c constant) Quantile(float64) float64 {
+	return float64(c)
+}
+
+func newExponential(ps DistParams) (Distribution, error) {
+	rate, err := ps.Float("rate", "lambda")
+	if err != nil {
+		return nil, err
+	}
+	if err := positive("rate", rate); err != nil {
+		return nil, err
+	}
+	return distuv.Exponential{Rate: rate}, nil
+}
+
+func newGamma(ps DistParams) (Distribution, error) {
+	alpha, err := ps.Float("alpha", "shape")
+	if err != nil {
+		return nil, err
+	}
+	beta, err := ps.Float("beta", "rate")
+	if err != nil {
+		return nil, err
+	}
+	if err := positive("alpha", alpha); err != nil {
+		return nil, err
+	}
+	if err := positive("beta", beta); err != nil {
+		return nil, err
+	}
+	return distuv.Gamma{Alpha: alpha, Beta: beta}, nil
+}
+
+func newLogNormal(ps DistParams) (Distribution, error) {
+	mu, err := ps.Float("mu")
+	if err != nil {
+		return nil, err
+	}
+	sigma, err := ps.Float("sigma")
+	if err != nil {
+		return nil, err
+	}
+	if err := positive("sigma", sigma); err != nil {
+		return nil, err
+	}
+	return distuv.LogNormal{Mu: mu, Sigma: sigma}, nil
+}
+
+func newPareto(ps DistParams) (Distribution, error) {
+	xm, err := ps.Float("xm")
+	if err != nil {
+		return nil, err
+	}
+	alpha, err := ps.Float("alpha")
+	if err != nil {
+		return nil, err
+	}
+	if err := positive("xm", xm); err != nil {
+		return nil, err
+	}
+	if err := positive("alpha", alpha); err != nil {
+		return nil, err
+	}
+	return distuv.Pareto{Xm: xm, Alpha: alpha}, nil
+}
+
+func newUniform(ps DistParams) (Distribution, error) {
+	min, err := ps.Float("min")
+	if err != nil {
+		return nil, err
+	}
+	max, err := ps.Float("max")
+	if err != nil {
+		return nil, err
+	}
+	if max <= min {
+		return nil, fmt.Errorf("parameter max (%v) must be greater than min (%v)", max, min)
+	}
+	return distuv.Uniform{Min: min, Max: max}, nil
+}
+
+func newWeibull(ps DistParams) (Distribution, error) {
+	k, err := ps.Float("k", "shape")
+	if err != nil {
+		return nil, err
+	}
+	lambda, err := ps.Float("lambda", "scale")
+	if err != nil {
+		return nil, err
+	}
+	if err := positive("k", k); err != nil {
+		return nil, err
+	}
+	if err := positive("lambda", lambda); err != nil {
+		return nil, err
+	}
+	return distuv.Weibull{K: k, Lambda: lambda}, nil
+}
+
+type poisson struct {
+	distuv.Poisson
+}
+
+func newPoisson(ps DistParams) (Distribution, error) {
+	lambda, err := ps.Float("lambda")
+	if err != nil {
+		return nil, err
+	}
+	if err := positive("lambda", lambda); err != nil {
+		return nil, err
+	}
+	return poisson{distuv.Poisson{Lambda: lambda}}, nil
+}
+
+// Quantile returns the smallest k such that CDF(k) >= u.
+func (d poisson) Quantile(u float64) float64 {
+	k := math.Floor(d.Lambda)
+	if d.CDF(k) >= u {
+		for k > 0 && d.CDF(k-1) >= u {
+			k--
+		}
+		return k
+	}
+	for d.CDF(k) < u {
+		k++
+	}
+	return k
+}
+
+// truncatedNormal is a normal distribution restricted to [min, max].
+type truncatedNormal struct {
+	normal     distuv.Normal
+	min, max   float64
+	cMin, cMax float64
+}
+
+func newTruncatedNormal(ps DistParams) (Distribution, error) {
+	mu, err := ps.Float("mu")
+	if err != nil {
+		return nil, err
+	}
+	sigma, err := ps.Float("sigma")
+	if err != nil {
+		return nil, err
+	}
+	if err := positive("sigma", sigma); err != nil {
+		return nil, err
+	}
+	// planned values are never negative, so the distribution is truncated at 0 unless told otherwise
+	min, err := ps.FloatOr(0, "min")
+	if err != nil {
+		return nil, err
+	}
+	max, err := ps.FloatOr(math.Inf(1), "max")
+	if err != nil {
+		return nil, err
+	}
+	if max <= min {
+		return nil, fmt.Errorf("parameter max (%v) must be greater than min (%v)", max, min)
+	}
+
+	n := distuv.Normal{Mu: mu, Sigma: sigma}
+	t := truncatedNormal{normal: n, min: min, max: max, cMin: n.CDF(min), cMax: n.CDF(max)}
+	if t.cMax-t.cMin < 1e-9 {
+		return nil, fmt.Errorf("range [%v, %v] has no probability mass", min, max)
+	}
+	return t, nil
+}
+
+func (t truncatedNormal) CDF(x float64) float64 {
+	switch {
+	case x <= t.min:
+		return 0
+	case x >= t.max:
+		return 1
+	}
+	return (t.normal.CDF(x) - t.cMin) / (t.cMax - t.cMin)
+}
+
+func (t truncatedNormal) LogProb(x float64) float64 {
+	if x < t.min || x > t.max {
+		return math.Inf(-1)
+	}
+	return t.normal.LogProb(x) - math.Log(t.cMax-t.cMin)
+}
+
+func (t truncatedNormal) Quantile(p float64) float64 {
+	x := t.normal.Quantile(t.cMin + p*(t.cMax-t.cMin))
+	return math.Min(math.Max(x, t.min), t.max)
+}
+
+// Empirical is a piecewise-linear distribution through the points (Values[i], Probs[i]).
+type Empirical struct {
+	Values []float64
+	Probs  []float64
+}
+
+func newEmpirical(ps DistParams) (Distribution, error) {
+	path, ok := ps["file"]
+	if !ok {
+		return nil, fmt.Errorf("parameter file is required")
+	}
+	return LoadEmpirical(path)
+}
+
+// LoadEmpirical reads an empirical distribution from a CSV file.
+// A file with one column holds samples, a file with two columns holds value,cumulative-probability pairs.
+func LoadEmpirical(path string) (*Empirical, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.Comment = '#'
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var xs, ps []float64
+	for i, rec := range records {
+		x, err := strconv.ParseFloat(strings.TrimSpace(rec[0]), 64)
+		if err != nil {
+			if i == 0 {
+				// header line
+				continue
+			}
+			return nil, fmt.Errorf("%s line %d: %w", path, i+1, err)
+		}
+		xs = append(xs, x)
+		if len(rec) > 1 {
+			p, err := strconv.ParseFloat(strings.TrimSpace(rec[1]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s line %d: %w", path, i+1, err)
+			}
+			ps = append(ps, p)
+		}
+	}
+
+	if len(ps) == 0 {
+		return NewEmpiricalFromSamples(xs)
+	}
+	if len(ps) != len(xs) {
+		return nil, fmt.Errorf("%s: every line must have both a value and a cumulative probability", path)
+	}
+	return NewEmpirical(xs, ps)
+}
+
+// NewEmpirical creates an empirical distribution from points of its CDF.
+func NewEmpirical(xs, ps []float64) (*Empirical, error) {
+	if len(xs) == 0 {
+		return nil, fmt.Errorf("empirical distribution has no points")
+	}
+	if len(xs) != len(ps) {
+		return nil, fmt.Errorf("empirical distribution has %d values but %d cumulative probabilities", len(xs), len(ps))
+	}
+	for i := range xs {
+		if math.IsNaN(xs[i]) || math.IsInf(xs[i], 0) {
+			return nil, fmt.Errorf("value %v at point %d is not finite", xs[i], i)
+		}
+		if !(ps[i] >= 0 && ps[i] <= 1) {
+			return nil, fmt.Errorf("cumulative probability %v is out of [0, 1]", ps[i])
+		}
+		if i > 0 && (xs[i] < xs[i-1] || ps[i] < ps[i-1]) {
+			return nil, fmt.Errorf("empirical CDF must be non-decreasing at point %d", i)
+		}
+	}
+	if ps[len(ps)-1] != 1 {
+		return nil, fmt.Errorf("empirical CDF must end with probability 1, got %v", ps[len(ps)-1])
+	}
+	return &Empirical{Values: xs, Probs: ps}, nil
+}
+
+// NewEmpiricalFromSamples creates an empirical distribution which interpolates between the sorted samples.
+func NewEmpiricalFromSamples(samples []float64) (*Empirical, error) {
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("empirical distribution has no samples")
+	}
+	xs := append([]float64(nil), samples...)
+	sort.Float64s(xs)
+	if len(xs) == 1 {
+		return &Empirical{Values: xs, Probs: []float64{1}}, nil
+	}
+
+	ps := make([]float64, len(xs))
+	for i := range ps {
+		ps[i] = float64(i) / float64(len(xs)-1)
+	}
+	return &Empirical{Values: xs, Probs: ps}, nil
+}
+
+func (e *Empirical) CDF(x float64) float64 {
+	n := len(e.Values)
+	if x < e.Values[0] {
+		return 0
+	}
+	if x >= e.Values[n-1] {
+		return 1
+	}
+	i := sort.Search(n, func(i int) bool { return e.Values[i] > x })
+	x0, x1 := e.Values[i-1], e.Values[i]
+	p0, p1 := e.Probs[i-1], e.Probs[i]
+	return p0 + (p1-p0)*(x-x0)/(x1-x0)
+}
+
+func (e *Empirical) Quantile(p float64) float64 {
+	n := len(e.Probs)
+	i := sort.Search(n, func(i int) bool { return e.Probs[i] >= p })
+	if i == 0 {
+		return e.Values[0]
+	}
+	if i == n {
+		return e.Values[n-1]
+	}
+	x0, x1 := e.Values[i-1], e.Values[i]
+	p0, p1 := e.Probs[i-1], e.Probs[i]
+	if p1 == p0 {
+		return x1
+	}
+	return x0 + (x1-x0)*(p-p0)/(p1-p0)
+}
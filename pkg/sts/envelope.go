@@ -0,0 +1,236 @@
+package sts
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const hoursPerDay = 24
+
+// Envelope is a time-of-day profile which scales the load of the generated cycles.
+type Envelope interface {
+	// Multiplier returns the load multiplier at the given hour of the day in [0, 24).
+	Multiplier(hour float64) float64
+}
+
+// ParseEnvelope parses an envelope spec:
+//
+//	sin:min=<m>,max=<m>,peak=<hour>          sinusoidal profile with a period of a day
+//	csv:file=<path>                          piecewise-linear profile from hour,multiplier lines
+//	step:<hour>=<m>,<hour>=<m>,...           step schedule
+//
+// Every kind also accepts start=<hour>, the hour of the day at which the plan starts.
+// An empty string returns a nil envelope.
+func ParseEnvelope(s string) (Envelope, float64, error) {
+	if s == "" {
+		return nil, 0, nil
+	}
+
+	kv := strings.SplitN(s, ":", 2)
+	ps := DistParams{}
+	if len(kv) == 2 && kv[1] != "" {
+		for _, param := range strings.Split(kv[1], ",") {
+			p := strings.SplitN(param, "=", 2)
+			if len(p) != 2 {
+				return nil, 0, fmt.Errorf("invalid envelope parameter %q: expected <key>=<value>", param)
+			}
+			ps[strings.TrimSpace(p[0])] = strings.TrimSpace(p[1])
+		}
+	}
+
+	start, err := ps.FloatOr(0, "start")
+	if err != nil {
+		return nil, 0, err
+	}
+	delete(ps, "start")
+
+	var e Envelope
+	switch kv[0] {
+	case "sin":
+		e, err = newSinusoidal(ps)
+	case "csv":
+		e, err = newPiecewiseLinear(ps)
+	case "step":
+		e, err = newStepSchedule(ps)
+	default:
+		return nil, 0, fmt.Errorf("unknown envelope %q (available: sin, csv, step)", kv[0])
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("envelope %s: %w", kv[0], err)
+	}
+	return e, start, nil
+}
+
+type sinusoidal struct {
+	min, max, peak float64
+}
+
+func newSinusoidal(ps DistParams) (Envelope, error) {
+	min, err := ps.Float("min")
+	if err != nil {
+		return nil, err
+	}
+	max, err := ps.Float("max")
+	if err != nil {
+		return nil, err
+	}
+	peak, err := ps.FloatOr(12, "peak")
+	if err != nil {
+		return nil, err
+	}
+	if err := positive("min", min); err != nil {
+		return nil, err
+	}
+	if max < min {
+		return nil, fmt.Errorf("parameter max (%v) must not be less than min (%v)", max, min)
+	}
+	return sinusoidal{min: min, max: max, peak: peak}, nil
+}
+
+func (s sinusoidal) Multiplier(hour float64) float64 {
+	return s.min + (s.max-s.min)*(1+math.Cos(2*math.Pi*(hour-s.peak)/hoursPerDay))/2
+}
+
+// schedule holds the multipliers of a profile sorted by hour.
+type schedule struct {
+	hours []float64
+	mults []float64
+}
+
+func newSchedule(hours, mults []float64) (schedule, error) {
+	if len(hours) == 0 {
+		return schedule{}, fmt.Errorf("profile has no points")
+	}
+	idx := make([]int, len(hours))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.Slice(idx, func(a, b int) bool { return hours[idx[a]] < hours[idx[b]] })
+
+	var s schedule
+	for _, i := range idx {
+		if hours[i] < 0 || hours[i] >= hoursPerDay {
+			return schedule{}, fmt.Errorf("hour %v is out of [0, 24)", hours[i])
+		}
+		if err := positive(fmt.Sprintf("multiplier at hour %v", hours[i]), mults[i]); err != nil {
+			return schedule{}, err
+		}
+		if n := len(s.hours); n > 0 && s.hours[n-1] == hours[i] {
+			return schedule{}, fmt.Errorf("hour %v is defined twice", hours[i])
+		}
+		s.hours = append(s.hours, hours[i])
+		s.mults = append(s.mults, mults[i])
+	}
+	return s, nil
+}
+
+// index returns the index of the last point at or before hour, wrapping to the last point of the previous day.
+func (s schedule) index(hour float64) int {
+	i := sort.Search(len(s.hours), func(i int) bool { return s.hours[i] > hour })
+	if i == 0 {
+		return len(s.hours) - 1
+	}
+	return i - 1
+}
+
+type stepSchedule struct {
+	schedule
+}
+
+func newStepSchedule(ps DistParams) (Envelope, error) {
+	var hours, mults []float64
+	for k := range ps {
+		h, err := strconv.ParseFloat(k, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hour %q", k)
+		}
+		m, err := ps.Float(k)
+		if err != nil {
+			return nil, err
+		}
+		hours = append(hours, h)
+		mults = append(mults, m)
+	}
+	s, err := newSchedule(hours, mults)
+	if err != nil {
+		return nil, err
+	}
+	return stepSchedule{s}, nil
+}
+
+func (s stepSchedule) Multiplier(hour float64) float64 {
+	return s.mults[s.index(hour)]
+}
+
+type piecewiseLinear struct {
+	schedule
+}
+
+func newPiecewiseLinear(ps DistParams) (Envelope, error) {
+	path, ok := ps["file"]
+	if !ok {
+		return nil, fmt.Errorf("parameter file is required")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var hours, mults []float64
+	for i, rec := range records {
+		if len(rec) != 2 {
+			return nil, fmt.Errorf("%s line %d: expected hour,multiplier", path, i+1)
+		}
+		h, err := strconv.ParseFloat(strings.TrimSpace(rec[0]), 64)
+		if err != nil {
+			if i == 0 {
+				// header line
+				continue
+			}
+			return nil, fmt.Errorf("%s line %d: %w", path, i+1, err)
+		}
+		m, err := strconv.ParseFloat(strings.TrimSpace(rec[1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", path, i+1, err)
+		}
+		hours = append(hours, h)
+		mults = append(mults, m)
+	}
+
+	s, err := newSchedule(hours, mults)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return piecewiseLinear{s}, nil
+}
+
+func (p piecewiseLinear) Multiplier(hour float64) float64 {
+	i := p.index(hour)
+	j := (i + 1) % len(p.hours)
+
+	h0, h1 := p.hours[i], p.hours[j]
+	if h1 <= h0 {
+		h1 += hoursPerDay
+	}
+	if hour < h0 {
+		hour += hoursPerDay
+	}
+	if h1 == h0 {
+		return p.mults[i]
+	}
+	return p.mults[i] + (p.mults[j]-p.mults[i])*(hour-h0)/(h1-h0)
+}
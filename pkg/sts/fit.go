@@ -0,0 +1,474 @@
+package sts
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/chez-shanpu/traffic-generator/pkg/traffic"
+	"gonum.org/v1/gonum/optimize"
+	"gonum.org/v1/gonum/stat"
+)
+
+// FitCandidates are the distributions which Fit tries by default.
+var FitCandidates = []string{"exponential", "gamma", "lognormal", "normal", "pareto", "weibull"}
+
+type fitter func(xs []float64) (DistParams, error)
+
+var fitters = map[string]fitter{
+	"exponential": fitExponential,
+	"gamma":       fitGamma,
+	"lognormal":   fitLogNormal,
+	"normal":      fitTruncatedNormal,
+	"pareto":      fitPareto,
+	"weibull":     fitWeibull,
+}
+
+// fitSignificance is the significance level of the Kolmogorov-Smirnov test below which a fitted candidate is
+// rejected.
+const fitSignificance = 0.05
+
+// FitResult is a distribution fitted to samples by maximum likelihood.
+type FitResult struct {
+	Spec          DistSpec
+	LogLikelihood float64
+	AIC           float64
+	KS            float64
+	// PValue is the p-value of the Kolmogorov-Smirnov distance. Candidates whose p-value is below
+	// fitSignificance are rejected.
+	PValue   float64
+	Rejected bool
+}
+
+// Fit fits each candidate distribution to the samples and returns the results ranked by AIC and then by the
+// Kolmogorov-Smirnov distance, after the candidates which the Kolmogorov-Smirnov test does not reject.
+// Candidates which cannot describe the samples are left out.
+func Fit(xs []float64, candidates []string) ([]FitResult, error) {
+	return fit(xs, candidates, false)
+}
+
+// FitCeiled fits the candidates to samples drawn from them and rounded up to whole numbers, as the send seconds
+// of plans are, by the likelihood of the rounded values, and ranks them like Fit.
+func FitCeiled(xs []float64, candidates []string) ([]FitResult, error) {
+	return fit(xs, candidates, true)
+}
+
+func fit(xs []float64, candidates []string, ceil bool) ([]FitResult, error) {
+	if len(xs) < 2 {
+		return nil, fmt.Errorf("at least 2 samples are required to fit a distribution, got %d", len(xs))
+	}
+
+	var rs []FitResult
+	for _, name := range candidates {
+		f, ok := fitters[name]
+		if !ok {
+			return nil, fmt.Errorf("distribution %q cannot be fitted (available: %s)", name, strings.Join(FitCandidates, ", "))
+		}
+		var ps DistParams
+		var err error
+		if ceil {
+			ps, err = fitCeiled(name, f, xs)
+		} else {
+			ps, err = f(xs)
+		}
+		if err != nil {
+			continue
+		}
+		spec := DistSpec{Name: name, Params: ps}
+		d, err := spec.New()
+		if err != nil {
+			continue
+		}
+
+		var ll float64
+		if ceil {
+			ll = ceiledLogLikelihood(d, xs)
+			d = ceiled{d}
+		} else {
+			ll = logLikelihood(d, xs)
+		}
+		if math.IsInf(ll, 0) || math.IsNaN(ll) {
+			continue
+		}
+		ks := KolmogorovSmirnov(xs, d)
+		pv := KolmogorovSmirnovPValue(ks, len(xs))
+		rs = append(rs, FitResult{
+			Spec:          spec,
+			LogLikelihood: ll,
+			AIC:           2*float64(len(ps)) - 2*ll,
+			KS:            ks,
+			PValue:        pv,
+			Rejected:      pv < fitSignificance,
+		})
+	}
+	if len(rs) == 0 {
+		return nil, fmt.Errorf("none of the distributions %s fits the samples", strings.Join(candidates, ", "))
+	}
+
+	sort.SliceStable(rs, func(i, j int) bool {
+		if rs[i].Rejected != rs[j].Rejected {
+			return !rs[i].Rejected
+		}
+		if rs[i].AIC != rs[j].AIC {
+			return rs[i].AIC < rs[j].AIC
+		}
+		return rs[i].KS < rs[j].KS
+	})
+	return rs, nil
+}
+
+type logProber interface {
+	LogProb(x float64) float64
+}
+
+func logLikelihood(d Distribution, xs []float64) float64 {
+	lp, ok := d.(logProber)
+	if !ok {
+		return math.NaN()
+	}
+	var ll float64
+	for _, x := range xs {
+		ll += lp.LogProb(x)
+	}
+	return ll
+}
+
+// fitCeiled fits the distribution of the fitter f to whole numbers rounded up from its values. The fit of the
+// midpoints of the rounding intervals is the start of the maximization of the likelihood of the intervals.
+func fitCeiled(name string, f fitter, xs []float64) (DistParams, error) {
+	mids := make([]float64, len(xs))
+	for i, x := range xs {
+		mids[i] = math.Ceil(x) - 0.5
+	}
+	start, err := f(mids)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(start))
+	for k := range start {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	init := make([]float64, len(keys))
+	for i, k := range keys {
+		if init[i], err = start.Float(k); err != nil {
+			return nil, err
+		}
+	}
+	params := func(x []float64) DistParams {
+		ps := DistParams{}
+		for i, k := range keys {
+			ps[k] = formatParam(x[i])
+		}
+		return ps
+	}
+
+	x, err := maximize(init, func(x []float64) float64 {
+		d, err := DistSpec{Name: name, Params: params(x)}.New()
+		if err != nil {
+			return math.Inf(-1)
+		}
+		return ceiledLogLikelihood(d, xs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return params(x), nil
+}
+
+// ceiledLogLikelihood returns the log-likelihood of whole numbers drawn from d and rounded up, the smallest of
+// which, 1, takes the draws below it too.
+func ceiledLogLikelihood(d Distribution, xs []float64) float64 {
+	var ll float64
+	for _, x := range xs {
+		k := math.Ceil(x)
+		lo := 0.0
+		if k > 1 {
+			lo = d.CDF(k - 1)
+		}
+		p := d.CDF(k) - lo
+		if !(p > 0) {
+			return math.Inf(-1)
+		}
+		ll += math.Log(p)
+	}
+	return ll
+}
+
+func formatParam(v float64) string {
+	return strconv.FormatFloat(v, 'g', 6, 64)
+}
+
+func requirePositive(xs []float64) error {
+	for _, x := range xs {
+		if x <= 0 {
+			return fmt.Errorf("samples must be positive")
+		}
+	}
+	return nil
+}
+
+// maximize returns the parameters which maximize the log-likelihood, starting from init.
+func maximize(init []float64, logLik func(x []float64) float64) ([]float64, error) {
+	p := optimize.Problem{
+		Func: func(x []float64) float64 {
+			ll := logLik(x)
+			if math.IsNaN(ll) {
+				return math.Inf(1)
+			}
+			return -ll
+		},
+	}
+	res, err := optimize.Minimize(p, init, nil, &optimize.NelderMead{})
+	if res == nil {
+		return nil, err
+	}
+	if math.IsInf(res.F, 0) || math.IsNaN(res.F) {
+		return nil, fmt.Errorf("likelihood did not converge")
+	}
+	return res.X, nil
+}
+
+func fitExponential(xs []float64) (DistParams, error) {
+	m := stat.Mean(xs, nil)
+	if m <= 0 {
+		return nil, fmt.Errorf("mean of samples must be positive")
+	}
+	return DistParams{"rate": formatParam(1 / m)}, nil
+}
+
+func fitLogNormal(xs []float64) (DistParams, error) {
+	if err := requirePositive(xs); err != nil {
+		return nil, err
+	}
+	ls := make([]float64, len(xs))
+	for i, x := range xs {
+		ls[i] = math.Log(x)
+	}
+	mu, sd := stat.PopMeanStdDev(ls, nil)
+	if sd <= 0 {
+		return nil, fmt.Errorf("samples have no variance")
+	}
+	return DistParams{"mu": formatParam(mu), "sigma": formatParam(sd)}, nil
+}
+
+func fitPareto(xs []float64) (DistParams, error) {
+	if err := requirePositive(xs); err != nil {
+		return nil, err
+	}
+	xm := math.Inf(1)
+	for _, x := range xs {
+		xm = math.Min(xm, x)
+	}
+	var sum float64
+	for _, x := range xs {
+		sum += math.Log(x / xm)
+	}
+	if sum <= 0 {
+		return nil, fmt.Errorf("samples have no variance")
+	}
+	// xm must not be rounded above the smallest sample, which would have no probability
+	xmStr := formatParam(xm)
+	if v, _ := strconv.ParseFloat(xmStr, 64); v > xm {
+		xmStr = strconv.FormatFloat(xm, 'g', -1, 64)
+	}
+	return DistParams{"xm": xmStr, "alpha": formatParam(float64(len(xs)) / sum)}, nil
+}
+
+func fitGamma(xs []float64) (DistParams, error) {
+	if err := requirePositive(xs); err != nil {
+		return nil, err
+	}
+	m, v := stat.PopMeanVariance(xs, nil)
+	if v <= 0 {
+		return nil, fmt.Errorf("samples have no variance")
+	}
+
+	x, err := maximize([]float64{math.Log(m * m / v), math.Log(m / v)}, func(x []float64) float64 {
+		d, err := newGamma(DistParams{"alpha": formatParam(math.Exp(x[0])), "beta": formatParam(math.Exp(x[1]))})
+		if err != nil {
+			return math.Inf(-1)
+		}
+		return logLikelihood(d, xs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return DistParams{"alpha": formatParam(math.Exp(x[0])), "beta": formatParam(math.Exp(x[1]))}, nil
+}
+
+func fitWeibull(xs []float64) (DistParams, error) {
+	if err := requirePositive(xs); err != nil {
+		return nil, err
+	}
+	m := stat.Mean(xs, nil)
+
+	x, err := maximize([]float64{0, math.Log(m)}, func(x []float64) float64 {
+		d, err := newWeibull(DistParams{"k": formatParam(math.Exp(x[0])), "lambda": formatParam(math.Exp(x[1]))})
+		if err != nil {
+			return math.Inf(-1)
+		}
+		return logLikelihood(d, xs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return DistParams{"k": formatParam(math.Exp(x[0])), "lambda": formatParam(math.Exp(x[1]))}, nil
+}
+
+// fitTruncatedNormal fits the normal distribution truncated at 0 which the planner samples.
+func fitTruncatedNormal(xs []float64) (DistParams, error) {
+	for _, x := range xs {
+		if x < 0 {
+			return nil, fmt.Errorf("samples must not be negative")
+		}
+	}
+	m, sd := stat.PopMeanStdDev(xs, nil)
+	if sd <= 0 {
+		return nil, fmt.Errorf("samples have no variance")
+	}
+
+	x, err := maximize([]float64{m, math.Log(sd)}, func(x []float64) float64 {
+		d, err := newTruncatedNormal(DistParams{"mu": formatParam(x[0]), "sigma": formatParam(math.Exp(x[1]))})
+		if err != nil {
+			return math.Inf(-1)
+		}
+		return logLikelihood(d, xs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return DistParams{"mu": formatParam(x[0]), "sigma": formatParam(math.Exp(x[1]))}, nil
+}
+
+// Samples are the bitrates, send seconds and wait seconds of a plan or of run results.
+type Samples struct {
+	Bitrates    []float64
+	SendSeconds []float64
+	WaitSeconds []float64
+	// SendCeiled reports whether the send seconds are the whole seconds of a plan rather than measured ones.
+	SendCeiled bool
+}
+
+// LoadSamples reads the samples from a params CSV written by tg init or a results CSV written by tg run.
+// JSON and YAML plans are read too. For results the bitrate and send seconds are the measured ones.
+// The wait after the last cycle and the Total line of results are not samples.
+func LoadSamples(path string) (*Samples, error) {
+	if traffic.FormatOf(path) != traffic.FormatCSV {
+		p, err := traffic.LoadPlan(path)
+		if err != nil {
+			return nil, err
+		}
+		return planSamples(p.Cycles), nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("%s has no cycles", path)
+	}
+
+	col := map[string]int{}
+	for i, h := range records[0] {
+		col[h] = i
+	}
+	get := func(rec []string, names ...string) (string, error) {
+		for _, n := range names {
+			if i, ok := col[n]; ok && i < len(rec) {
+				return rec[i], nil
+			}
+		}
+		return "", fmt.Errorf("%s has no %s column", path, names[0])
+	}
+	_, results := col["SendByte"]
+
+	s := &Samples{SendCeiled: !results}
+	rows := records[1:]
+	for i, rec := range rows {
+		if rec[0] == "Total" {
+			rows = rows[:i]
+			break
+		}
+	}
+	for i, rec := range rows {
+		line := i + 2
+
+		sendStr, err := get(rec, "SendSeconds", "SendSecond")
+		if err != nil {
+			return nil, err
+		}
+		send, err := strconv.ParseFloat(sendStr, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", path, line, err)
+		}
+
+		var bitrate float64
+		if results {
+			bs, err := get(rec, "SendByte")
+			if err != nil {
+				return nil, err
+			}
+			b, err := strconv.ParseFloat(bs, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s line %d: %w", path, line, err)
+			}
+			if send <= 0 {
+				// the cycle failed, so there is nothing measured
+				continue
+			}
+			bitrate = b * 8 / send
+		} else {
+			bs, err := get(rec, "Bitrate")
+			if err != nil {
+				return nil, err
+			}
+			b, err := traffic.ParseBitrate(bs)
+			if err != nil {
+				return nil, fmt.Errorf("%s line %d: %w", path, line, err)
+			}
+			bitrate = float64(b)
+		}
+		s.Bitrates = append(s.Bitrates, bitrate)
+		s.SendSeconds = append(s.SendSeconds, send)
+
+		if i < len(rows)-1 {
+			ws, err := get(rec, "WaitMilliSeconds", "WaitMilliSecond")
+			if err != nil {
+				return nil, err
+			}
+			w, err := strconv.ParseFloat(ws, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s line %d: %w", path, line, err)
+			}
+			// waits are whole milliseconds, so a zero wait is taken as half of the resolution
+			s.WaitSeconds = append(s.WaitSeconds, math.Max(w, 0.5)/1000)
+		}
+	}
+	return s, nil
+}
+
+func planSamples(ps traffic.Params) *Samples {
+	s := &Samples{SendCeiled: true}
+	for i, p := range ps {
+		s.Bitrates = append(s.Bitrates, float64(p.Bitrate))
+		s.SendSeconds = append(s.SendSeconds, float64(p.SendSeconds))
+		if i < len(ps)-1 {
+			// waits are whole milliseconds, so a zero wait is taken as half of the resolution
+			s.WaitSeconds = append(s.WaitSeconds, math.Max(float64(p.WaitMilliSeconds), 0.5)/1000)
+		}
+	}
+	return s
+}
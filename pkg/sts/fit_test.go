@@ -0,0 +1,113 @@
+package sts
+
+import (
+	"math"
+	"sort"
+	"testing"
+
+	"github.com/chez-shanpu/traffic-generator/pkg/option"
+	"gonum.org/v1/gonum/stat"
+)
+
+func generateSendSeconds(t *testing.T, cfg option.Config) []float64 {
+	t.Helper()
+	p, err := NewPlanner(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps, err := p.GenerateTrafficParams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	xs := make([]float64, len(ps))
+	for i, p := range ps {
+		xs[i] = float64(p.SendSeconds)
+	}
+	return xs
+}
+
+func p99(xs []float64) float64 {
+	s := append([]float64(nil), xs...)
+	sort.Float64s(s)
+	return stat.Quantile(0.99, stat.Empirical, s, nil)
+}
+
+// TestFitCeiledRoundTrip checks that a plan generated from the fitted send distribution of a plan has the send
+// seconds of the original plan.
+func TestFitCeiledRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		sendDist string
+		lambda   float64
+	}{
+		{"exponential", "", 0.5},
+		{"pareto", "pareto:xm=1,alpha=2.5", 0},
+		{"lognormal", "lognormal:mu=1,sigma=0.5", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := option.Config{Cycle: 3000, Seed: 3, Bitrate: "1M", WaitSeconds: 1, ConstraintMethod: ConstraintTruncate, SendLambda: tt.lambda, SendDist: tt.sendDist}
+			xs := generateSendSeconds(t, cfg)
+
+			rs, err := FitCeiled(xs, FitCandidates)
+			if err != nil {
+				t.Fatal(err)
+			}
+			best := rs[0]
+			if best.Rejected {
+				t.Fatalf("the best fit %s is rejected with KS %.4f", best.Spec, best.KS)
+			}
+
+			cfg.Seed = 4
+			cfg.SendLambda = 0
+			cfg.SendDist = best.Spec.String()
+			ys := generateSendSeconds(t, cfg)
+
+			if m, n := stat.Mean(xs, nil), stat.Mean(ys, nil); math.Abs(n-m) > 0.05*m {
+				t.Errorf("mean send seconds %.3f of the plan of %s, expected %.3f", n, best.Spec, m)
+			}
+			if q, r := p99(xs), p99(ys); math.Abs(r-q) > 0.25*q {
+				t.Errorf("p99 send seconds %v of the plan of %s, expected %v", r, best.Spec, q)
+			}
+		})
+	}
+}
+
+func TestFitCeiledExponentialRate(t *testing.T) {
+	xs := generateSendSeconds(t, option.Config{Cycle: 3000, Seed: 5, Bitrate: "1M", WaitSeconds: 1, ConstraintMethod: ConstraintTruncate, SendLambda: 0.5})
+	rs, err := FitCeiled(xs, []string{"exponential"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rate, err := rs[0].Spec.Params.Float("rate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(rate-0.5) > 0.05 {
+		t.Errorf("fitted rate %v, expected 0.5", rate)
+	}
+}
+
+func TestFitRanksRejectedLast(t *testing.T) {
+	// uniform samples, which the exponential distribution fits with a good AIC but a poor KS distance
+	xs := make([]float64, 500)
+	for i := range xs {
+		xs[i] = 10 + float64(i)/100
+	}
+	rs, err := Fit(xs, FitCandidates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := false
+	for _, r := range rs {
+		if r.Rejected {
+			seen = true
+		} else if seen {
+			t.Errorf("%s is ranked after a rejected candidate", r.Spec)
+		}
+		if r.Rejected != (r.PValue < fitSignificance) {
+			t.Errorf("%s: rejected %v with p-value %v", r.Spec, r.Rejected, r.PValue)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package sts
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/chez-shanpu/traffic-generator/pkg/option"
+	"github.com/chez-shanpu/traffic-generator/pkg/traffic"
+)
+
+// NewFlowPlanners returns a planner for each flow configuration.
+// Flows draw independent random streams from the same seed.
+func NewFlowPlanners(cfgs []option.Config) ([]*Planner, error) {
+	ps := make([]*Planner, len(cfgs))
+	for i, cfg := range cfgs {
+		p, err := NewPlanner(cfg)
+		if err != nil {
+			if len(cfgs) > 1 {
+				return nil, fmt.Errorf("flow %d: %w", i, err)
+			}
+			return nil, err
+		}
+		p.Flow = i
+		ps[i] = p
+	}
+	return ps, nil
+}
+
+// GenerateFlows generates the cycles of every planner.
+func GenerateFlows(ps []*Planner) ([]traffic.Params, error) {
+	fs := make([]traffic.Params, len(ps))
+	for i, p := range ps {
+		ts, err := p.GenerateTrafficParams()
+		if err != nil {
+			if len(ps) > 1 {
+				return nil, fmt.Errorf("flow %d: %w", p.Flow, err)
+			}
+			return nil, err
+		}
+		fs[i] = ts
+	}
+	return fs, nil
+}
+
+// MergeFlows merges the cycles generated by every planner into a plan in the order of their start offsets.
+// Flows are numbered in the order of the planners, and every flow of the arrival model gets a number of its own.
+func MergeFlows(ps []*Planner, fs []traffic.Params) traffic.Params {
+	var ts traffic.Params
+	var flow int
+	for i, p := range ps {
+		for _, t := range fs[i] {
+			t.Flow = flow
+			if p.SrcAddr != "" {
+				t.SrcAddr = p.SrcAddr
+			}
+			if p.DstAddr != "" {
+				t.DstAddr = p.DstAddr
+			}
+			if p.DstPort != "" {
+				t.DstPort = p.DstPort
+			}
+			if p.Model == ModelArrival {
+				flow++
+			}
+		}
+		if p.Model != ModelArrival {
+			flow++
+		}
+		ts = append(ts, fs[i]...)
+	}
+
+	sort.SliceStable(ts, func(i, j int) bool {
+		return ts[i].StartMilliSeconds < ts[j].StartMilliSeconds
+	})
+	return ts
+}
@@ -0,0 +1,104 @@
+package sts
+
+import (
+	"math"
+	"sort"
+)
+
+// ceiled is the distribution of a value drawn from d and rounded up to an integer, as send seconds are.
+type ceiled struct {
+	Distribution
+}
+
+func (c ceiled) CDF(x float64) float64 {
+	return c.Distribution.CDF(math.Floor(x))
+}
+
+func (c ceiled) Quantile(p float64) float64 {
+	return math.Ceil(c.Distribution.Quantile(p))
+}
+
+// KolmogorovSmirnov returns the largest distance between the empirical CDF of xs and the CDF of d.
+func KolmogorovSmirnov(xs []float64, d Distribution) float64 {
+	if len(xs) == 0 {
+		return 0
+	}
+	s := append([]float64(nil), xs...)
+	sort.Float64s(s)
+
+	n := float64(len(s))
+	var dist float64
+	for i := 0; i < len(s); {
+		// step over ties so that the empirical CDF is evaluated once per distinct value
+		j := i
+		for j < len(s) && s[j] == s[i] {
+			j++
+		}
+		f := d.CDF(s[i])
+		// the empirical CDF just below s[i] is compared with the left limit of the CDF
+		fl := d.CDF(math.Nextafter(s[i], math.Inf(-1)))
+		dist = math.Max(dist, math.Max(math.Abs(float64(j)/n-f), math.Abs(fl-float64(i)/n)))
+		i = j
+	}
+	return dist
+}
+
+// KolmogorovSmirnovPValue returns the asymptotic p-value of the Kolmogorov-Smirnov distance d of n samples,
+// with the small sample correction of Stephens.
+func KolmogorovSmirnovPValue(d float64, n int) float64 {
+	if n == 0 {
+		return 1
+	}
+	sn := math.Sqrt(float64(n))
+	l := (sn + 0.12 + 0.11/sn) * d
+	if l < 1e-3 {
+		return 1
+	}
+
+	var p float64
+	for j := 1; j <= 100; j++ {
+		term := math.Exp(-2 * float64(j*j) * l * l)
+		if j%2 == 1 {
+			p += term
+		} else {
+			p -= term
+		}
+		if term < 1e-12 {
+			break
+		}
+	}
+	return math.Min(math.Max(2*p, 0), 1)
+}
+
+// AndersonDarling returns the Anderson-Darling statistic of xs against the CDF of d.
+func AndersonDarling(xs []float64, d Distribution) float64 {
+	if len(xs) == 0 {
+		return 0
+	}
+	s := append([]float64(nil), xs...)
+	sort.Float64s(s)
+
+	n := len(s)
+	var sum float64
+	for i := 0; i < n; i++ {
+		lo := clampUnit(d.CDF(s[i]))
+		hi := clampUnit(d.CDF(s[n-1-i]))
+		sum += float64(2*i+1) * (math.Log(lo) + math.Log(1-hi))
+	}
+	return -float64(n) - sum/float64(n)
+}
+
+// AndersonDarlingPValue returns the asymptotic p-value of the Anderson-Darling statistic a
+// of a fully specified distribution (Marsaglia and Marsaglia, 2004).
+func AndersonDarlingPValue(a float64) float64 {
+	if a <= 0 {
+		return 1
+	}
+	var cdf float64
+	if a < 2 {
+		cdf = math.Exp(-1.2337141/a) / math.Sqrt(a) * (2.00012 + (0.247105-(0.0649821-(0.0347962-(0.011672-0.00168691*a)*a)*a)*a)*a)
+	} else {
+		cdf = math.Exp(-math.Exp(1.0776 - (2.30695-(0.43424-(0.082433-(0.008056-0.0003146*a)*a)*a)*a)*a))
+	}
+	return math.Min(math.Max(1-cdf, 0), 1)
+}
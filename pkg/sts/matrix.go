@@ -0,0 +1,254 @@
+package sts
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/chez-shanpu/traffic-generator/pkg/option"
+	"github.com/chez-shanpu/traffic-generator/pkg/traffic"
+	"golang.org/x/exp/rand"
+)
+
+const (
+	MatrixUniform     = "uniform"
+	MatrixGravity     = "gravity"
+	MatrixHotspot     = "hotspot"
+	MatrixPermutation = "permutation"
+	MatrixAllToAll    = "all-to-all"
+)
+
+// Endpoint is a host of a traffic matrix.
+type Endpoint struct {
+	Addr string
+	// Weight is the mass of the endpoint in the gravity model.
+	Weight float64
+}
+
+// ParseEndpoints returns endpoints of weight 1 with the given addresses.
+func ParseEndpoints(addrs []string) []Endpoint {
+	eps := make([]Endpoint, len(addrs))
+	for i, a := range addrs {
+		eps[i] = Endpoint{Addr: strings.TrimSpace(a), Weight: 1}
+	}
+	return eps
+}
+
+// LoadEndpoints reads endpoints from a file of address[,weight] lines. Lines starting with '#' are comments.
+func LoadEndpoints(path string) ([]Endpoint, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var eps []Endpoint
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		l := strings.TrimSpace(sc.Text())
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		fs := strings.Split(l, ",")
+		ep := Endpoint{Addr: strings.TrimSpace(fs[0]), Weight: 1}
+		if len(fs) > 1 {
+			if ep.Weight, err = strconv.ParseFloat(strings.TrimSpace(fs[1]), 64); err != nil {
+				return nil, fmt.Errorf("%s line %d: invalid weight: %w", path, line, err)
+			}
+		}
+		eps = append(eps, ep)
+	}
+	return eps, sc.Err()
+}
+
+// Matrix is a traffic matrix between endpoints.
+type Matrix struct {
+	Model     string
+	Endpoints []Endpoint
+	// Demand[i][j] is the share of the traffic of endpoint i sent to endpoint j.
+	Demand [][]float64
+	// Scale[i] multiplies the bitrates of endpoint i.
+	Scale []float64
+}
+
+// NewMatrix creates a traffic matrix of the given model.
+//
+//	uniform      every source sends to the other endpoints alike
+//	gravity      sources send in proportion to their weight, to destinations in proportion to theirs
+//	hotspot      sources send hotFraction of their traffic to the first hotspots endpoints
+//	permutation  every source sends to a single destination of a random permutation
+//	all-to-all   every source sends to every other endpoint at once
+func NewMatrix(model string, eps []Endpoint, hotspots int, hotFraction float64, seed uint64) (*Matrix, error) {
+	n := len(eps)
+	if n < 2 {
+		return nil, fmt.Errorf("traffic matrix needs at least 2 endpoints, got %d", n)
+	}
+	seen := map[string]bool{}
+	for _, ep := range eps {
+		if ep.Addr == "" {
+			return nil, fmt.Errorf("endpoint without address")
+		}
+		if seen[ep.Addr] {
+			return nil, fmt.Errorf("endpoint %s is given twice", ep.Addr)
+		}
+		if ep.Weight <= 0 {
+			return nil, fmt.Errorf("weight %v of endpoint %s must be positive", ep.Weight, ep.Addr)
+		}
+		seen[ep.Addr] = true
+	}
+
+	m := &Matrix{Model: model, Endpoints: eps, Demand: make([][]float64, n), Scale: make([]float64, n)}
+	for i := range m.Demand {
+		m.Demand[i] = make([]float64, n)
+		m.Scale[i] = 1
+	}
+
+	switch model {
+	case MatrixUniform, MatrixAllToAll:
+		m.fill(func(i, j int) float64 { return 1 })
+	case MatrixGravity:
+		var sum float64
+		for _, ep := range eps {
+			sum += ep.Weight
+		}
+		// sources send in proportion to their weight at the mean bitrate of the planner on average
+		for i, ep := range eps {
+			m.Scale[i] = ep.Weight * float64(n) / sum
+		}
+		m.fill(func(i, j int) float64 { return eps[j].Weight })
+	case MatrixHotspot:
+		if hotspots < 1 || hotspots >= n {
+			return nil, fmt.Errorf("number of hotspots %d must be in [1, %d)", hotspots, n)
+		}
+		if hotFraction < 0 || hotFraction > 1 {
+			return nil, fmt.Errorf("hotspot fraction %v must be in [0, 1]", hotFraction)
+		}
+		m.fill(func(i, j int) float64 {
+			hot, cold := hotspots, n-hotspots
+			if i < hotspots {
+				hot--
+			} else {
+				cold--
+			}
+			switch {
+			case j < hotspots && cold == 0:
+				return 1
+			case j < hotspots:
+				return hotFraction / float64(hot)
+			case hot == 0:
+				return 1
+			default:
+				return (1 - hotFraction) / float64(cold)
+			}
+		})
+	case MatrixPermutation:
+		// Sattolo's algorithm draws a cyclic permutation, so no endpoint sends to itself
+		perm := make([]int, n)
+		for i := range perm {
+			perm[i] = i
+		}
+		r := rand.New(rand.NewSource(subSeed(seed, 0, destinationStream)))
+		for i := n - 1; i > 0; i-- {
+			j := r.Intn(i)
+			perm[i], perm[j] = perm[j], perm[i]
+		}
+		for i, j := range perm {
+			m.Demand[i][j] = 1
+		}
+	default:
+		return nil, fmt.Errorf("unknown traffic matrix %q", model)
+	}
+	return m, nil
+}
+
+// fill sets the demands between different endpoints from weights, normalized per source.
+func (m *Matrix) fill(weight func(i, j int) float64) {
+	for i, row := range m.Demand {
+		var sum float64
+		for j := range row {
+			if i != j {
+				row[j] = weight(i, j)
+				sum += row[j]
+			}
+		}
+		for j := range row {
+			if sum > 0 {
+				row[j] /= sum
+			}
+		}
+	}
+}
+
+// Generate generates the plans of all sources with planners configured by cfg.
+// Every source sends to port basePort plus its index, so that each endpoint can serve all sources with
+// servers on consecutive ports. With the all-to-all model every pair is a flow of its own, otherwise
+// every source is a flow whose cycles go to destinations drawn from its demands.
+func (m *Matrix) Generate(cfg option.Config, basePort int) (traffic.Params, error) {
+	var ps []*Planner
+	var fs []traffic.Params
+	for i, src := range m.Endpoints {
+		// the destinations of the flows of the source, or -1 for a flow routed by the demands
+		dsts := []int{-1}
+		if m.Model == MatrixAllToAll {
+			dsts = nil
+			for j := range m.Endpoints {
+				if j != i {
+					dsts = append(dsts, j)
+				}
+			}
+		}
+
+		for _, j := range dsts {
+			p, err := NewPlanner(cfg)
+			if err != nil {
+				return nil, err
+			}
+			p.Flow = len(ps)
+			p.SrcAddr = src.Addr
+			p.DstPort = strconv.Itoa(basePort + i)
+			if j >= 0 {
+				p.DstAddr = m.Endpoints[j].Addr
+			}
+
+			ts, err := p.GenerateTrafficParams()
+			if err != nil {
+				return nil, fmt.Errorf("source %s: %w", src.Addr, err)
+			}
+			if j < 0 {
+				m.route(p, i, ts)
+			}
+			ps = append(ps, p)
+			fs = append(fs, ts)
+		}
+	}
+	return MergeFlows(ps, fs), nil
+}
+
+// route draws the destination of every cycle of source i and scales its bitrates.
+func (m *Matrix) route(p *Planner, i int, ts traffic.Params) {
+	row := m.Demand[i]
+	for k, u := range p.uniforms(destinationStream, len(ts)) {
+		j := len(row) - 1
+		var cum float64
+		for l, d := range row {
+			cum += d
+			if u < cum {
+				j = l
+				break
+			}
+		}
+		for row[j] == 0 {
+			// rounding left u beyond the last destination
+			j--
+		}
+		ts[k].DstAddr = m.Endpoints[j].Addr
+		if m.Scale[i] != 1 {
+			ts[k].Bitrate = (ts[k].Bitrate * traffic.Bitrate(m.Scale[i])).Clamp(p.BitrateMin, p.BitrateMax)
+			if ts[k].FlowBytes > 0 {
+				ts[k].SetFlowBytes(ts[k].FlowBytes)
+			}
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package sts
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+
+	"github.com/chez-shanpu/traffic-generator/pkg/option"
+	"github.com/chez-shanpu/traffic-generator/pkg/traffic"
+	"gopkg.in/yaml.v2"
+)
+
+// MarkovState is a regime of a Markov-modulated model with its own distributions.
+// Distributions which are left empty fall back to the ones of the planner.
+type MarkovState struct {
+	Name        string `yaml:"name"`
+	BitrateDist string `yaml:"bitrate-dist"`
+	SendDist    string `yaml:"send-dist"`
+	WaitDist    string `yaml:"wait-dist"`
+
+	bitrate Distribution
+	send    Distribution
+	wait    Distribution
+}
+
+// MarkovModel is a discrete-time Markov chain which switches the regime at every cycle.
+type MarkovModel struct {
+	Initial     string        `yaml:"initial"`
+	States      []MarkovState `yaml:"states"`
+	Transitions [][]float64   `yaml:"transitions"`
+
+	initial int
+}
+
+// LoadMarkovModel reads a Markov-modulated model from a YAML file.
+func LoadMarkovModel(path string) (*MarkovModel, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &MarkovModel{}
+	if err := yaml.UnmarshalStrict(b, m); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := m.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+func (m *MarkovModel) validate() error {
+	n := len(m.States)
+	if n == 0 {
+		return fmt.Errorf("markov model has no states")
+	}
+
+	names := map[string]int{}
+	for i, s := range m.States {
+		if s.Name == "" {
+			return fmt.Errorf("state %d has no name", i)
+		}
+		if _, ok := names[s.Name]; ok {
+			return fmt.Errorf("state %q is defined twice", s.Name)
+		}
+		names[s.Name] = i
+	}
+
+	if m.Initial != "" {
+		i, ok := names[m.Initial]
+		if !ok {
+			return fmt.Errorf("initial state %q is not defined", m.Initial)
+		}
+		m.initial = i
+	}
+
+	if len(m.Transitions) != n {
+		return fmt.Errorf("transition matrix has %d rows, expected %d", len(m.Transitions), n)
+	}
+	for i, row := range m.Transitions {
+		if len(row) != n {
+			return fmt.Errorf("transition matrix row %d has %d columns, expected %d", i, len(row), n)
+		}
+		var sum float64
+		for _, v := range row {
+			if v < 0 {
+				return fmt.Errorf("transition matrix row %d has a negative probability", i)
+			}
+			sum += v
+		}
+		if math.Abs(sum-1) > 1e-9 {
+			return fmt.Errorf("transition matrix row %d sums to %v, expected 1", i, sum)
+		}
+	}
+	return nil
+}
+
+// resolve creates the distributions of every state, falling back to the given ones, and checks that they have
+// finite means.
+func (m *MarkovModel) resolve(bitrate, send, wait Distribution) error {
+	var err error
+	for i := range m.States {
+		s := &m.States[i]
+		if s.bitrate, err = distOrDefault(s.BitrateDist, bitrate); err != nil {
+			return fmt.Errorf("state %s: %w", s.Name, err)
+		}
+		if s.send, err = distOrDefault(s.SendDist, send); err != nil {
+			return fmt.Errorf("state %s: %w", s.Name, err)
+		}
+		if s.wait, err = distOrDefault(s.WaitDist, wait); err != nil {
+			return fmt.Errorf("state %s: %w", s.Name, err)
+		}
+		for _, d := range []struct {
+			flag string
+			dist Distribution
+		}{
+			{option.BitrateDist, s.bitrate},
+			{option.SendDist, s.send},
+			{option.WaitDist, s.wait},
+		} {
+			if m := distMean(d.dist); math.IsNaN(m) || math.IsInf(m, 0) {
+				return fmt.Errorf("state %s: the %s has no finite mean", s.Name, d.flag)
+			}
+		}
+	}
+	return nil
+}
+
+// distMean approximates the mean of a distribution by integrating its quantile function.
+func distMean(d Distribution) float64 {
+	const n = 10000
+	var sum float64
+	for i := 0; i < n; i++ {
+		sum += d.Quantile((float64(i) + 0.5) / n)
+	}
+	return sum / n
+}
+
+func (m *MarkovModel) next(state int, u float64) int {
+	var acc float64
+	for j, v := range m.Transitions[state] {
+		acc += v
+		if u < acc {
+			return j
+		}
+	}
+	// rounding errors may leave u above the sum of the row
+	for j := len(m.Transitions[state]) - 1; j >= 0; j-- {
+		if m.Transitions[state][j] > 0 {
+			return j
+		}
+	}
+	return state
+}
+
+// GenerateMarkovParams walks the Markov chain and draws every cycle from the distributions of the current state.
+func (p Planner) GenerateMarkovParams() traffic.Params {
+	var ts traffic.Params
+
+	m := p.Markov
+	states := p.uniforms(stateStream, p.CycleNum)
+	bits := p.uniforms(bitrateStream, p.CycleNum)
+	sends := p.uniforms(sendStream, p.CycleNum)
+	waits := p.uniforms(waitStream, p.CycleNum)
+
+	state := m.initial
+	for i := 0; i < p.CycleNum; i++ {
+		if i > 0 {
+			state = m.next(state, states[i])
+		}
+		s := m.States[state]
+
+		t := &traffic.Param{
+			Bitrate:     p.bitrate(s.bitrate, bits[i]),
+			SendSeconds: p.sendSeconds(s.send, sends[i]),
+			State:       s.Name,
+		}
+		if i < p.CycleNum-1 {
+			t.WaitMilliSeconds = waitMilliSeconds(s.wait, waits[i])
+		}
+		ts = append(ts, t)
+	}
+	return ts
+}
@@ -23,43 +23,270 @@ THE SOFTWARE.
 package sts
 
 import (
+	"fmt"
 	"math"
-	"strconv"
 
 	"github.com/chez-shanpu/traffic-generator/pkg/option"
 
 	"github.com/chez-shanpu/traffic-generator/pkg/traffic"
-	"golang.org/x/exp/rand"
 	"gonum.org/v1/gonum/stat/distuv"
 )
 
+const (
+	ModelRenewal     = "renewal"
+	ModelMarkov      = "mmpp"
+	ModelSelfSimilar = "selfsimilar"
+	ModelArrival     = "arrival"
+)
+
 type Planner struct {
-	CycleNum      int
-	Seed          uint64
-	SendLambda    float64
-	SendSeconds   int64
-	WaitLambda    float64
-	WaitSeconds   int64
-	Bitrate       string
-	BitrateLambda float64
-	BitrateUnit   string
-}
-
-func NewPlanner(cfg option.Config) *Planner {
+	Model       string
+	Markov      *MarkovModel
+	Hurst       float64
+	ArrivalDist Distribution
+	CycleNum    int
+	Seed        uint64
+	Flow        int
+	SrcAddr     string
+	DstAddr     string
+	DstPort     string
+	Correlation *Correlation
+	SendDist    Distribution
+	SendSeconds int64
+	WaitDist    Distribution
+	WaitSeconds int64
+	Bitrate     traffic.Bitrate
+	BitrateDist Distribution
+	BitrateUnit traffic.Bitrate
+	BitrateMin  traffic.Bitrate
+	BitrateMax  traffic.Bitrate
+	SizeDist    Distribution
+
+	Envelope        Envelope
+	EnvelopeStart   float64
+	TimeCompression float64
+
+	Constraints Constraints
+
+	// specs describes the distributions of the bitrate, send and wait streams.
+	specs map[stream]string
+}
+
+func NewPlanner(cfg option.Config) (*Planner, error) {
+	if cfg.Cycle < 1 {
+		return nil, fmt.Errorf("the number of cycles must be at least 1, got %d", cfg.Cycle)
+	}
+	if cfg.Workload != "" {
+		var err error
+		if cfg, err = applyWorkload(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	corr, err := ParseCorrelation(cfg.Correlation)
+	if err != nil {
+		return nil, err
+	}
+	sd, err := distOrDefault(cfg.SendDist, distuv.Exponential{Rate: cfg.SendLambda})
+	if err != nil {
+		return nil, err
+	}
+	wd, err := distOrDefault(cfg.WaitDist, distuv.Exponential{Rate: cfg.WaitLambda})
+	if err != nil {
+		return nil, err
+	}
+	bd, err := distOrDefault(cfg.BitrateDist, poisson{distuv.Poisson{Lambda: cfg.BitrateLambda}})
+	if err != nil {
+		return nil, err
+	}
+	b, err := parseBitrateOr(cfg.Bitrate, 0)
+	if err != nil {
+		return nil, err
+	}
+	unit, err := traffic.ParseBitrate("1" + cfg.BitrateUnit)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bitrate unit %q", cfg.BitrateUnit)
+	}
+	bmin, err := parseBitrateOr(cfg.BitrateMin, unit)
+	if err != nil {
+		return nil, err
+	}
+	bmax, err := parseBitrateOr(cfg.BitrateMax, 0)
+	if err != nil {
+		return nil, err
+	}
+	if bmax > 0 && bmax < bmin {
+		return nil, fmt.Errorf("maximum bitrate %s is less than minimum bitrate %s", bmax, bmin)
+	}
+
+	var size Distribution
+	if cfg.SizeDist != "" {
+		if size, err = NewDistribution(cfg.SizeDist); err != nil {
+			return nil, err
+		}
+	}
+
+	env, envStart, err := ParseEnvelope(cfg.Envelope)
+	if err != nil {
+		return nil, err
+	}
+	if env != nil && cfg.TimeCompression <= 0 {
+		return nil, fmt.Errorf("time compression %v must be positive", cfg.TimeCompression)
+	}
+
+	cons := Constraints{
+		Method:      cfg.ConstraintMethod,
+		MaxDuration: traffic.MilliSecond(cfg.MaxDuration * 1000),
+		TargetBytes: cfg.TargetBytes,
+		Tolerance:   cfg.TargetTolerance,
+		SendMin:     traffic.Second(cfg.SendMin),
+		SendMax:     traffic.Second(cfg.SendMax),
+	}
+	if err := cons.validate(); err != nil {
+		return nil, err
+	}
+
+	var markov *MarkovModel
+	var ad Distribution
+	switch cfg.Model {
+	case "", ModelRenewal:
+	case ModelMarkov:
+		if cfg.MarkovModel == "" {
+			return nil, fmt.Errorf("--%s is required for the %s model", option.MarkovModel, ModelMarkov)
+		}
+		if markov, err = LoadMarkovModel(cfg.MarkovModel); err != nil {
+			return nil, err
+		}
+		// states without distributions use the fixed values of the flags, or the distributions
+		fb, fs, fw := bd, sd, wd
+		if b > 0 {
+			fb = constant(b / unit)
+		}
+		if cfg.SendSeconds > 0 {
+			fs = constant(cfg.SendSeconds)
+		}
+		if cfg.WaitSeconds > 0 {
+			fw = constant(cfg.WaitSeconds)
+		}
+		if err = markov.resolve(fb, fs, fw); err != nil {
+			return nil, err
+		}
+	case ModelSelfSimilar:
+		if cfg.Hurst <= 0 || cfg.Hurst >= 1 {
+			return nil, fmt.Errorf("hurst parameter %v must be in (0, 1)", cfg.Hurst)
+		}
+		if _, err := periodMean(option.SendSeconds, option.SendDist, sd, cfg.SendSeconds); err != nil {
+			return nil, err
+		}
+		if _, err := periodMean(option.WaitSeconds, option.WaitDist, wd, cfg.WaitSeconds); err != nil {
+			return nil, err
+		}
+	case ModelArrival:
+		if cfg.ArrivalDist == "" && cfg.ArrivalRate <= 0 {
+			return nil, fmt.Errorf("--%s or --%s is required for the %s model", option.ArrivalRate, option.ArrivalDist, ModelArrival)
+		}
+		if ad, err = distOrDefault(cfg.ArrivalDist, distuv.Exponential{Rate: cfg.ArrivalRate}); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown model %q", cfg.Model)
+	}
+
 	return &Planner{
-		CycleNum:      cfg.Cycle,
-		Seed:          cfg.Seed,
-		SendLambda:    cfg.SendLambda,
-		SendSeconds:   cfg.SendSeconds,
-		WaitLambda:    cfg.WaitLambda,
-		WaitSeconds:   cfg.WaitSeconds,
-		Bitrate:       cfg.Bitrate,
-		BitrateLambda: cfg.BitrateLambda,
-		BitrateUnit:   cfg.BitrateUnit,
+		Model:       cfg.Model,
+		Markov:      markov,
+		Hurst:       cfg.Hurst,
+		ArrivalDist: ad,
+		CycleNum:    cfg.Cycle,
+		Seed:        cfg.Seed,
+		SrcAddr:     cfg.SrcAddr,
+		DstAddr:     cfg.DstAddr,
+		DstPort:     cfg.DstPort,
+		Correlation: corr,
+		SendDist:    sd,
+		SendSeconds: cfg.SendSeconds,
+		WaitDist:    wd,
+		WaitSeconds: cfg.WaitSeconds,
+		Bitrate:     b,
+		BitrateDist: bd,
+		BitrateUnit: unit,
+		BitrateMin:  bmin,
+		BitrateMax:  bmax,
+		SizeDist:    size,
+
+		Envelope:        env,
+		EnvelopeStart:   envStart,
+		TimeCompression: cfg.TimeCompression,
+
+		Constraints: cons,
+
+		specs: map[stream]string{
+			bitrateStream: specOr(cfg.BitrateDist, fmt.Sprintf("poisson:lambda=%v", cfg.BitrateLambda)),
+			sendStream:    specOr(cfg.SendDist, fmt.Sprintf("exponential:rate=%v", cfg.SendLambda)),
+			waitStream:    specOr(cfg.WaitDist, fmt.Sprintf("exponential:rate=%v", cfg.WaitLambda)),
+		},
+	}, nil
+}
+
+func parseBitrateOr(s string, def traffic.Bitrate) (traffic.Bitrate, error) {
+	if s == "" {
+		return def, nil
+	}
+	return traffic.ParseBitrate(s)
+}
+
+func specOr(spec, def string) string {
+	if spec == "" {
+		return def
+	}
+	return spec
+}
+
+func distOrDefault(spec string, def Distribution) (Distribution, error) {
+	if spec == "" {
+		return def, nil
+	}
+	return NewDistribution(spec)
+}
+
+func (p *Planner) GenerateTrafficParams() (traffic.Params, error) {
+	if p.Constraints.Method != ConstraintReject || !p.Constraints.hasTotals() {
+		return p.applyConstraints(p.generate())
+	}
+
+	q := *p
+	for i := 0; i < maxRejections; i++ {
+		if i > 0 {
+			q.Seed = splitmix64(p.Seed + uint64(i))
+		}
+		if ts := q.generate(); p.Constraints.satisfied(ts) {
+			return ts, nil
+		}
+	}
+	return nil, fmt.Errorf("no plan satisfying the constraints was found in %d draws", maxRejections)
+}
+
+func (p Planner) generate() traffic.Params {
+	var ts traffic.Params
+
+	switch p.Model {
+	case ModelMarkov:
+		ts = p.GenerateMarkovParams()
+	case ModelSelfSimilar:
+		ts = p.GenerateSelfSimilarParams()
+	case ModelArrival:
+		// arrivals are scheduled as they are drawn
+		return p.GenerateArrivalParams()
+	default:
+		ts = p.GenerateRenewalParams()
 	}
+
+	p.sizes(ts)
+	p.schedule(ts)
+	return ts
 }
 
-func (p *Planner) GenerateTrafficParams() traffic.Params {
+func (p *Planner) GenerateRenewalParams() traffic.Params {
 	var ts traffic.Params
 
 	bits := p.GenerateBitrates()
@@ -77,42 +304,67 @@ func (p *Planner) GenerateTrafficParams() traffic.Params {
 	return ts
 }
 
+// schedule sets the start offset of every cycle.
+// If the planner has an envelope, the bitrate of each cycle is multiplied and its wait divided by the envelope
+// at the hour of the day the cycle starts, with the plan time scaled by the time compression factor.
+func (p Planner) schedule(ts traffic.Params) {
+	var start traffic.MilliSecond
+	for _, t := range ts {
+		t.StartMilliSeconds = start
+		if p.Envelope != nil {
+			m := p.Envelope.Multiplier(p.hourOfDay(start))
+			t.Bitrate = (t.Bitrate * traffic.Bitrate(m)).Clamp(p.BitrateMin, p.BitrateMax)
+			t.WaitMilliSeconds = traffic.MilliSecond(float64(t.WaitMilliSeconds) / m)
+			if t.FlowBytes > 0 {
+				t.SetFlowBytes(t.FlowBytes)
+			}
+		}
+		start += traffic.MilliSecond(t.SendSeconds)*1000 + t.WaitMilliSeconds
+	}
+}
+
+// sizes draws the flow size of every cycle from SizeDist, if the planner has one.
+func (p Planner) sizes(ts traffic.Params) {
+	if p.SizeDist == nil {
+		return
+	}
+	for i, u := range p.uniforms(sizeStream, len(ts)) {
+		ts[i].SetFlowBytes(flowBytes(p.SizeDist, u))
+	}
+}
+
+func flowBytes(d Distribution, u float64) int64 {
+	b := int64(math.Ceil(d.Quantile(u)))
+	if b < 1 {
+		b = 1
+	}
+	return b
+}
+
+func (p Planner) hourOfDay(offset traffic.MilliSecond) float64 {
+	h := p.EnvelopeStart + float64(offset)/1000*p.TimeCompression/3600
+	return math.Mod(math.Mod(h, hoursPerDay)+hoursPerDay, hoursPerDay)
+}
+
 func (p *Planner) GenerateBitrates() []traffic.Bitrate {
 	var bs []traffic.Bitrate
 
-	if len(p.Bitrate) != 0 {
+	if p.Bitrate != 0 {
 		for i := 0; i < p.CycleNum; i++ {
-			bs = append(bs, traffic.Bitrate(p.Bitrate))
+			bs = append(bs, p.Bitrate)
 		}
 	} else {
 		bs = p.GenerateRandomBitrates()
 	}
 
-	if len(p.BitrateUnit) != 0 {
-		var newbs []traffic.Bitrate
-		for _, b := range bs {
-			b += traffic.Bitrate(p.BitrateUnit)
-			newbs = append(newbs, b)
-		}
-		bs = newbs
-	}
-
 	return bs
 }
 
+// GenerateRandomBitrates draws bitrates in units of BitrateUnit and clamps them to [BitrateMin, BitrateMax].
 func (p Planner) GenerateRandomBitrates() []traffic.Bitrate {
-	ps := distuv.Poisson{
-		Lambda: p.BitrateLambda,
-		Src:    rand.NewSource(p.Seed),
-	}
-
 	var bs []traffic.Bitrate
-	for i := 0; i < p.CycleNum; i++ {
-		b := math.Round(ps.Rand())
-		if b < 1 {
-			b = 1
-		}
-		bs = append(bs, traffic.Bitrate(strconv.FormatFloat(b, 'f', -1, 64)))
+	for _, u := range p.uniforms(bitrateStream, p.CycleNum) {
+		bs = append(bs, p.bitrate(p.BitrateDist, u))
 	}
 
 	return bs
@@ -133,15 +385,9 @@ func (p Planner) GenerateSendSeconds() []traffic.Second {
 }
 
 func (p Planner) GenerateRandomSendSeconds() []traffic.Second {
-	ps := distuv.Exponential{
-		Rate: p.SendLambda,
-		Src:  rand.NewSource(p.Seed),
-	}
-
 	var ss []traffic.Second
-	for i := 0; i < p.CycleNum; i++ {
-		s := traffic.Second(math.Ceil(ps.Rand()))
-		ss = append(ss, s)
+	for _, u := range p.uniforms(sendStream, p.CycleNum) {
+		ss = append(ss, p.sendSeconds(p.SendDist, u))
 	}
 	return ss
 }
@@ -163,15 +409,60 @@ func (p Planner) GenerateWaitMilliSeconds() []traffic.MilliSecond {
 }
 
 func (p Planner) GenerateRandomWaitMilliSeconds() []traffic.MilliSecond {
-	e := distuv.Exponential{
-		Rate: p.WaitLambda,
-		Src:  rand.NewSource(p.Seed),
-	}
-
 	var ms []traffic.MilliSecond
-	for i := 0; i < p.CycleNum-1; i++ {
-		m := traffic.MilliSecond(e.Rand() * 1000)
-		ms = append(ms, m)
+	for _, u := range p.uniforms(waitStream, p.CycleNum-1) {
+		ms = append(ms, waitMilliSeconds(p.WaitDist, u))
 	}
 	return ms
 }
+
+func (p Planner) bitrate(d Distribution, u float64) traffic.Bitrate {
+	if p.Constraints.Method == ConstraintReject {
+		max := math.Inf(1)
+		if p.BitrateMax > 0 {
+			max = float64(p.BitrateMax / p.BitrateUnit)
+		}
+		u = within(d, u, float64(p.BitrateMin/p.BitrateUnit), max)
+	}
+	b := traffic.Bitrate(d.Quantile(u)) * p.BitrateUnit
+	return b.Clamp(p.BitrateMin, p.BitrateMax)
+}
+
+func (p Planner) sendSeconds(d Distribution, u float64) traffic.Second {
+	if p.Constraints.Method == ConstraintReject {
+		max := math.Inf(1)
+		if p.Constraints.SendMax > 0 {
+			max = float64(p.Constraints.SendMax)
+		}
+		// send seconds are rounded up, so a draw in (min-1, max] is within the bounds
+		u = within(d, u, float64(p.Constraints.SendMin-1), max)
+	}
+	s := traffic.Second(math.Ceil(clampDraw(d.Quantile(u))))
+	return p.Constraints.clampSend(s)
+}
+
+// within maps u onto the quantiles of d between min and max, which is equivalent to
+// redrawing until the value falls within the bounds.
+func within(d Distribution, u, min, max float64) float64 {
+	lo, hi := d.CDF(min), d.CDF(max)
+	if hi <= lo {
+		return u
+	}
+	return clampUnit(lo + u*(hi-lo))
+}
+
+func waitMilliSeconds(d Distribution, u float64) traffic.MilliSecond {
+	return traffic.MilliSecond(clampDraw(d.Quantile(u)) * 1000)
+}
+
+// maxDrawSeconds bounds the durations drawn from distributions, so that heavy tails and distributions without a
+// finite mean cannot overflow the durations of a plan.
+const maxDrawSeconds = 1e9
+
+// clampDraw clamps a drawn duration in seconds to [0, maxDrawSeconds].
+func clampDraw(s float64) float64 {
+	if !(s > 0) {
+		return 0
+	}
+	return math.Min(s, maxDrawSeconds)
+}
@@ -0,0 +1,161 @@
+package sts
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+
+	"github.com/chez-shanpu/traffic-generator/pkg/option"
+	"github.com/chez-shanpu/traffic-generator/pkg/traffic"
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/dsp/fourier"
+	"gonum.org/v1/gonum/stat"
+	"gonum.org/v1/gonum/stat/distuv"
+)
+
+// GenerateSelfSimilarParams generates a plan whose traffic is long-range dependent with the Hurst parameter of the planner.
+// Bitrates follow fractional Gaussian noise mapped onto the bitrate distribution, unless the bitrate is fixed, and send
+// and wait durations are Pareto ON/OFF periods with shape 3-2H whose means are the fixed send and wait durations or the
+// means of the send and wait distributions.
+func (p Planner) GenerateSelfSimilarParams() traffic.Params {
+	var ts traffic.Params
+
+	alpha := 3 - 2*p.Hurst
+	// NewPlanner checked that the means are finite
+	onMean, _ := periodMean(option.SendSeconds, option.SendDist, p.SendDist, p.SendSeconds)
+	offMean, _ := periodMean(option.WaitSeconds, option.WaitDist, p.WaitDist, p.WaitSeconds)
+	on := paretoWithMean(alpha, onMean)
+	off := paretoWithMean(alpha, offMean)
+
+	fgn := FractionalGaussianNoise(p.CycleNum, p.Hurst, p.source(bitrateStream))
+	sends := p.uniforms(sendStream, p.CycleNum)
+	waits := p.uniforms(waitStream, p.CycleNum)
+
+	for i := 0; i < p.CycleNum; i++ {
+		t := &traffic.Param{
+			Bitrate:     p.Bitrate,
+			SendSeconds: p.sendSeconds(on, sends[i]),
+		}
+		if p.Bitrate == 0 {
+			t.Bitrate = p.bitrate(p.BitrateDist, clampUnit(distuv.UnitNormal.CDF(fgn[i])))
+		}
+		if i < p.CycleNum-1 {
+			t.WaitMilliSeconds = waitMilliSeconds(off, waits[i])
+		}
+		ts = append(ts, t)
+	}
+	return ts
+}
+
+// periodMean returns the mean of the ON or OFF periods, the fixed duration if it is given or else the mean of the
+// distribution, which must be finite and positive. The flags of the duration and the distribution are named in errors.
+func periodMean(fixedFlag, distFlag string, d Distribution, fixed int64) (float64, error) {
+	if fixed > 0 {
+		return float64(fixed), nil
+	}
+	m := distMean(d)
+	if math.IsNaN(m) || math.IsInf(m, 0) || m <= 0 {
+		return 0, fmt.Errorf("--%s has no finite positive mean, give --%s or a --%s with one", distFlag, fixedFlag, distFlag)
+	}
+	return m, nil
+}
+
+func paretoWithMean(alpha, mean float64) Distribution {
+	return distuv.Pareto{Xm: mean * (alpha - 1) / alpha, Alpha: alpha}
+}
+
+// FractionalGaussianNoise returns n standard normal values with the autocorrelation of fractional Gaussian noise
+// with Hurst parameter h, generated by the Davies-Harte circulant embedding method.
+func FractionalGaussianNoise(n int, h float64, src rand.Source) []float64 {
+	if n == 0 {
+		return nil
+	}
+
+	m := 1
+	for m < n {
+		m <<= 1
+	}
+
+	// first row of the circulant matrix which embeds the autocovariance
+	c := make([]complex128, 2*m)
+	for k := 0; k <= m; k++ {
+		c[k] = complex(fgnAutocovariance(k, h), 0)
+	}
+	for k := m + 1; k < 2*m; k++ {
+		c[k] = c[2*m-k]
+	}
+
+	fft := fourier.NewCmplxFFT(2 * m)
+	lambda := fft.Coefficients(nil, c)
+
+	r := rand.New(src)
+	w := make([]complex128, 2*m)
+	for j := 0; j <= m; j++ {
+		l := math.Max(real(lambda[j]), 0)
+		switch j {
+		case 0, m:
+			w[j] = complex(math.Sqrt(l/float64(2*m))*r.NormFloat64(), 0)
+		default:
+			s := math.Sqrt(l / float64(4*m))
+			w[j] = complex(s*r.NormFloat64(), s*r.NormFloat64())
+			w[2*m-j] = cmplx.Conj(w[j])
+		}
+	}
+
+	z := fft.Coefficients(nil, w)
+	xs := make([]float64, n)
+	for i := range xs {
+		xs[i] = real(z[i])
+	}
+	return xs
+}
+
+func fgnAutocovariance(k int, h float64) float64 {
+	kf := float64(k)
+	return 0.5 * (math.Pow(math.Abs(kf+1), 2*h) - 2*math.Pow(kf, 2*h) + math.Pow(math.Abs(kf-1), 2*h))
+}
+
+// RateSeries returns the bits sent in every second of the plan timeline.
+func RateSeries(ps traffic.Params) []float64 {
+	var xs []float64
+	var carry float64
+	for _, p := range ps {
+		for s := traffic.Second(0); s < p.SendSeconds; s++ {
+			xs = append(xs, float64(p.Bitrate))
+		}
+		carry += float64(p.WaitMilliSeconds) / 1000
+		for ; carry >= 1; carry-- {
+			xs = append(xs, 0)
+		}
+	}
+	return xs
+}
+
+// EstimateHurst estimates the Hurst exponent of a series by the aggregated variance method.
+func EstimateHurst(xs []float64) (float64, error) {
+	const minBlocks = 8
+	if len(xs) < 4*minBlocks {
+		return 0, fmt.Errorf("the series has %d values, at least %d are required to estimate the Hurst exponent", len(xs), 4*minBlocks)
+	}
+
+	var logM, logV []float64
+	for m := 1; len(xs)/m >= minBlocks; m *= 2 {
+		blocks := len(xs) / m
+		agg := make([]float64, blocks)
+		for b := 0; b < blocks; b++ {
+			agg[b] = stat.Mean(xs[b*m:(b+1)*m], nil)
+		}
+		v := stat.Variance(agg, nil)
+		if v <= 0 {
+			continue
+		}
+		logM = append(logM, math.Log(float64(m)))
+		logV = append(logV, math.Log(v))
+	}
+	if len(logM) < 2 {
+		return 0, fmt.Errorf("the series has no variance to estimate the Hurst exponent")
+	}
+
+	_, beta := stat.LinearRegression(logM, logV, nil, false)
+	return 1 + beta/2, nil
+}
@@ -0,0 +1,93 @@
+package sts
+
+import (
+	"math"
+
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/stat/distuv"
+)
+
+type stream int
+
+const (
+	bitrateStream stream = iota
+	sendStream
+	waitStream
+	stateStream
+	arrivalStream
+	sizeStream
+	destinationStream
+)
+
+// correlatedStreams is the number of streams which take part in the correlation model.
+const correlatedStreams = 3
+
+var streamNames = map[string]stream{
+	"bitrate": bitrateStream,
+	"send":    sendStream,
+	"wait":    waitStream,
+}
+
+// subSeed derives a reproducible seed for the stream of the given flow from the planner seed.
+func subSeed(seed uint64, flow int, s stream) uint64 {
+	return splitmix64(seed ^ splitmix64(uint64(flow)<<16|uint64(s)))
+}
+
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+func (p Planner) source(s stream) rand.Source {
+	return rand.NewSource(subSeed(p.Seed, p.Flow, s))
+}
+
+// uniforms returns n values in (0, 1) drawn from stream s.
+// If the planner has a correlation model the values are coupled with the other streams by a Gaussian copula.
+func (p Planner) uniforms(s stream, n int) []float64 {
+	if n <= 0 {
+		return nil
+	}
+	if p.Correlation != nil && int(s) < correlatedStreams {
+		return p.correlatedUniforms(n)[s]
+	}
+
+	r := rand.New(p.source(s))
+	us := make([]float64, n)
+	for i := range us {
+		us[i] = openUniform(r)
+	}
+	return us
+}
+
+func (p Planner) correlatedUniforms(n int) [correlatedStreams][]float64 {
+	var rs [correlatedStreams]*rand.Rand
+	for i := range rs {
+		rs[i] = rand.New(p.source(stream(i)))
+	}
+
+	var us [correlatedStreams][]float64
+	z := make([]float64, correlatedStreams)
+	for i := 0; i < n; i++ {
+		for j := range z {
+			z[j] = rs[j].NormFloat64()
+		}
+		x := p.Correlation.couple(z)
+		for j := range us {
+			us[j] = append(us[j], clampUnit(distuv.UnitNormal.CDF(x[j])))
+		}
+	}
+	return us
+}
+
+// openUniform returns a uniform value in the open interval (0, 1) so that quantile functions never see 0 or 1.
+func openUniform(r *rand.Rand) float64 {
+	return (float64(r.Uint64()>>11) + 0.5) / (1 << 53)
+}
+
+func clampUnit(u float64) float64 {
+	const eps = 1.0 / (1 << 53)
+	return math.Min(math.Max(u, eps), 1-eps)
+}
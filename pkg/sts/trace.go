@@ -0,0 +1,139 @@
+package sts
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/chez-shanpu/traffic-generator/pkg/pcap"
+	"github.com/chez-shanpu/traffic-generator/pkg/traffic"
+)
+
+// DefaultIdleGap is the gap between packets of a flow which ends an ON period unless given otherwise.
+const DefaultIdleGap = time.Second
+
+// Trace is a packet trace grouped into flows.
+type Trace struct {
+	// Start is the time of the first packet of the trace.
+	Start time.Time
+	// Flows are sorted by bytes in descending order.
+	Flows []*TraceFlow
+}
+
+// TraceFlow is a unidirectional flow of a trace split into ON periods.
+type TraceFlow struct {
+	Key     pcap.FlowKey
+	Bytes   int64
+	Packets int
+	Bursts  []*Burst
+}
+
+// Burst is an ON period of a flow.
+type Burst struct {
+	Start   time.Time
+	End     time.Time
+	Bytes   int64
+	Packets int
+}
+
+// LoadTrace reads the TCP and UDP flows of a pcap or pcapng file.
+// Packets of a flow more than idle apart belong to different ON periods.
+func LoadTrace(path string, idle time.Duration) (*Trace, error) {
+	if idle <= 0 {
+		return nil, fmt.Errorf("idle gap must be positive: %v", idle)
+	}
+
+	r, err := pcap.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	t := &Trace{}
+	flows := map[pcap.FlowKey]*TraceFlow{}
+	n := 0
+	for {
+		pkt, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: packet %d: %w", path, n+1, err)
+		}
+		n++
+
+		key, ok := pkt.Flow()
+		if !ok {
+			continue
+		}
+		if t.Start.IsZero() || pkt.Timestamp.Before(t.Start) {
+			t.Start = pkt.Timestamp
+		}
+
+		f, ok := flows[key]
+		if !ok {
+			f = &TraceFlow{Key: key}
+			flows[key] = f
+			t.Flows = append(t.Flows, f)
+		}
+		f.add(pkt.Timestamp, int64(pkt.Length), idle)
+	}
+	if len(t.Flows) == 0 {
+		return nil, fmt.Errorf("%s: no TCP or UDP flows", path)
+	}
+
+	sort.SliceStable(t.Flows, func(i, j int) bool {
+		return t.Flows[i].Bytes > t.Flows[j].Bytes
+	})
+	return t, nil
+}
+
+func (f *TraceFlow) add(ts time.Time, bytes int64, idle time.Duration) {
+	f.Bytes += bytes
+	f.Packets++
+
+	if len(f.Bursts) > 0 {
+		b := f.Bursts[len(f.Bursts)-1]
+		// captures from several interfaces may be slightly out of order
+		if ts.Sub(b.End) <= idle {
+			if ts.After(b.End) {
+				b.End = ts
+			}
+			if ts.Before(b.Start) {
+				b.Start = ts
+			}
+			b.Bytes += bytes
+			b.Packets++
+			return
+		}
+	}
+	f.Bursts = append(f.Bursts, &Burst{Start: ts, End: ts, Bytes: bytes, Packets: 1})
+}
+
+// Params returns a plan replaying the ON periods of the flow, with start offsets relative to origin.
+// Send durations are rounded up to whole seconds and bitrates chosen so that every cycle sends
+// the bytes of its ON period.
+func (f *TraceFlow) Params(origin time.Time) traffic.Params {
+	ps := make(traffic.Params, len(f.Bursts))
+	for i, b := range f.Bursts {
+		send := traffic.Second(math.Ceil(b.End.Sub(b.Start).Seconds()))
+		if send < 1 {
+			send = 1
+		}
+		ps[i] = &traffic.Param{
+			Bitrate:           traffic.Bitrate(float64(b.Bytes*8) / float64(send)),
+			SendSeconds:       send,
+			StartMilliSeconds: traffic.MilliSecond(b.Start.Sub(origin) / time.Millisecond),
+		}
+	}
+
+	for i := 0; i < len(ps)-1; i++ {
+		end := ps[i].StartMilliSeconds + traffic.MilliSecond(ps[i].SendSeconds)*1000
+		if wait := ps[i+1].StartMilliSeconds - end; wait > 0 {
+			ps[i].WaitMilliSeconds = wait
+		}
+	}
+	return ps
+}
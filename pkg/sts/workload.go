@@ -0,0 +1,157 @@
+package sts
+
+import (
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+
+	"github.com/chez-shanpu/traffic-generator/pkg/option"
+	"github.com/chez-shanpu/traffic-generator/pkg/traffic"
+	"gopkg.in/yaml.v2"
+)
+
+// Parameters a workload describes.
+const (
+	WorkloadSize    = "size"
+	WorkloadBitrate = "bitrate"
+)
+
+//go:embed workloads/*.yaml
+var workloadFiles embed.FS
+
+// Workload is an empirical distribution of flow sizes or bitrates measured in a well-known environment.
+type Workload struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	// Parameter is the parameter the workload describes, WorkloadSize or WorkloadBitrate.
+	Parameter string `yaml:"parameter"`
+	// Unit is the unit of the values of the CDF, bytes for sizes and bits/s for bitrates.
+	Unit string `yaml:"unit"`
+	// Citation is the publication the points of the CDF are taken from. Synthetic workloads have none.
+	Citation string `yaml:"citation"`
+	// Synthetic is set when the points of the CDF are not measured but shaped by hand.
+	Synthetic bool   `yaml:"synthetic"`
+	Note      string `yaml:"note"`
+	// CDF holds the value,cumulative-probability points of the distribution.
+	CDF [][2]float64 `yaml:"cdf"`
+}
+
+var workloads = map[string]*Workload{}
+
+func init() {
+	RegisterDistribution("workload", newWorkloadDist)
+
+	files, err := workloadFiles.ReadDir("workloads")
+	if err != nil {
+		panic(err)
+	}
+	for _, f := range files {
+		b, err := workloadFiles.ReadFile(path.Join("workloads", f.Name()))
+		if err != nil {
+			panic(err)
+		}
+		w := &Workload{}
+		if err := yaml.UnmarshalStrict(b, w); err != nil {
+			panic(fmt.Sprintf("workload %s: %v", f.Name(), err))
+		}
+		if w.Synthetic == (w.Citation != "") {
+			panic(fmt.Sprintf("workload %s: either a citation or synthetic is required", w.Name))
+		}
+		if _, err := w.Distribution(1); err != nil {
+			panic(fmt.Sprintf("workload %s: %v", w.Name, err))
+		}
+		workloads[w.Name] = w
+	}
+}
+
+// Workloads returns the built-in workloads sorted by name.
+func Workloads() []*Workload {
+	var ws []*Workload
+	for _, w := range workloads {
+		ws = append(ws, w)
+	}
+	sort.Slice(ws, func(i, j int) bool {
+		return ws[i].Name < ws[j].Name
+	})
+	return ws
+}
+
+// LookupWorkload returns the built-in workload of the given name.
+func LookupWorkload(name string) (*Workload, error) {
+	w, ok := workloads[name]
+	if !ok {
+		var names []string
+		for _, w := range Workloads() {
+			names = append(names, w.Name)
+		}
+		return nil, fmt.Errorf("unknown workload %q (known: %v)", name, names)
+	}
+	return w, nil
+}
+
+// Distribution returns the empirical distribution of the workload, interpolating linearly between
+// the points of its CDF, with the values multiplied by scale.
+func (w *Workload) Distribution(scale float64) (*Empirical, error) {
+	xs := make([]float64, len(w.CDF))
+	ps := make([]float64, len(w.CDF))
+	for i, pt := range w.CDF {
+		xs[i] = pt[0] * scale
+		ps[i] = pt[1]
+	}
+	return NewEmpirical(xs, ps)
+}
+
+// newWorkloadDist creates the distribution of a built-in workload from the parameters name and
+// scale (default 1), the factor the values of the workload are multiplied by.
+func newWorkloadDist(ps DistParams) (Distribution, error) {
+	name, ok := ps["name"]
+	if !ok {
+		return nil, fmt.Errorf("parameter name is required")
+	}
+	w, err := LookupWorkload(name)
+	if err != nil {
+		return nil, err
+	}
+	scale, err := ps.FloatOr(1, "scale")
+	if err != nil {
+		return nil, err
+	}
+	if scale <= 0 {
+		return nil, fmt.Errorf("scale %v must be positive", scale)
+	}
+	return w.Distribution(scale)
+}
+
+// applyWorkload sets the distribution of the parameter the workload of the configuration describes.
+// Bitrate workloads are scaled to the bitrate unit.
+func applyWorkload(cfg option.Config) (option.Config, error) {
+	w, err := LookupWorkload(cfg.Workload)
+	if err != nil {
+		return cfg, err
+	}
+
+	switch w.Parameter {
+	case WorkloadSize:
+		if cfg.SizeDist != "" {
+			return cfg, fmt.Errorf("--%s and --%s are exclusive", option.Workload, option.SizeDist)
+		}
+		cfg.SizeDist = "workload:name=" + w.Name
+	case WorkloadBitrate:
+		if cfg.BitrateDist != "" {
+			return cfg, fmt.Errorf("--%s and --%s are exclusive", option.Workload, option.BitrateDist)
+		}
+		unit, err := traffic.ParseBitrate("1" + cfg.BitrateUnit)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid bitrate unit %q", cfg.BitrateUnit)
+		}
+		cfg.BitrateDist = "workload:name=" + w.Name
+		if unit != 1 {
+			cfg.BitrateDist += ",scale=" + strconv.FormatFloat(1/float64(unit), 'g', -1, 64)
+		}
+	default:
+		return cfg, fmt.Errorf("workload %s describes unknown parameter %q", w.Name, w.Parameter)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,106 @@
+package traffic
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Bitrate is a traffic rate in bits per second.
+type Bitrate float64
+
+type bitrateUnit struct {
+	suffix string
+	factor float64
+}
+
+// units are ordered so that longer suffixes are matched first.
+var units = []bitrateUnit{
+	{"Ki", 1 << 10},
+	{"Mi", 1 << 20},
+	{"Gi", 1 << 30},
+	{"Ti", 1 << 40},
+	{"k", 1e3},
+	{"K", 1e3},
+	{"M", 1e6},
+	{"G", 1e9},
+	{"T", 1e12},
+}
+
+// formatUnits are the SI units used by String, largest first.
+var formatUnits = []bitrateUnit{
+	{"T", 1e12},
+	{"G", 1e9},
+	{"M", 1e6},
+	{"K", 1e3},
+}
+
+// ParseBitrate parses a bitrate such as "100", "1.5M", "10Gi" or "64Kbps".
+// SI prefixes (K, M, G, T) are powers of 1000 like iperf3 and IEC prefixes (Ki, Mi, Gi, Ti) are powers of 1024.
+func ParseBitrate(s string) (Bitrate, error) {
+	str := strings.TrimSpace(s)
+	for _, suffix := range []string{"bit/s", "b/s", "bps"} {
+		if strings.HasSuffix(str, suffix) {
+			str = strings.TrimSuffix(str, suffix)
+			break
+		}
+	}
+
+	factor := 1.0
+	for _, u := range units {
+		if strings.HasSuffix(str, u.suffix) {
+			str = strings.TrimSuffix(str, u.suffix)
+			factor = u.factor
+			break
+		}
+	}
+
+	v, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid bitrate %q", s)
+	}
+	if v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("invalid bitrate %q: must be a finite non-negative number", s)
+	}
+	return Bitrate(v * factor), nil
+}
+
+// String formats the bitrate with the largest SI prefix which keeps the value exact.
+func (b Bitrate) String() string {
+	v := float64(b)
+	for _, u := range formatUnits {
+		if v < u.factor {
+			continue
+		}
+		s := strconv.FormatFloat(v/u.factor, 'f', -1, 64)
+		if f, err := strconv.ParseFloat(s, 64); err == nil && f*u.factor == v {
+			return s + u.suffix
+		}
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// Clamp limits the bitrate to [min, max]. A max of 0 means no upper bound.
+func (b Bitrate) Clamp(min, max Bitrate) Bitrate {
+	if b < min {
+		return min
+	}
+	if max > 0 && b > max {
+		return max
+	}
+	return b
+}
+
+func (b Bitrate) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+func (b *Bitrate) UnmarshalText(text []byte) error {
+	v, err := ParseBitrate(string(text))
+	if err != nil {
+		return err
+	}
+	*b = v
+	return nil
+}
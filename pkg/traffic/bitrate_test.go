@@ -0,0 +1,148 @@
+package traffic
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseBitrate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Bitrate
+	}{
+		{"100", 100},
+		{"0", 0},
+		{"0.5", 0.5},
+		{"1.5M", 1.5e6},
+		{"64k", 64e3},
+		{"64K", 64e3},
+		{"10G", 10e9},
+		{"2T", 2e12},
+		{"1Ki", 1024},
+		{"2.5Mi", 2.5 * (1 << 20)},
+		{"10Gi", 10 * (1 << 30)},
+		{"1Ti", 1 << 40},
+		{"64Kbps", 64e3},
+		{"1.5Mb/s", 1.5e6},
+		{"1Gibit/s", 1 << 30},
+		{" 3G ", 3e9},
+	}
+	for _, tt := range tests {
+		got, err := ParseBitrate(tt.in)
+		if err != nil {
+			t.Errorf("ParseBitrate(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseBitrate(%q) = %v, expected %v", tt.in, float64(got), float64(tt.want))
+		}
+	}
+}
+
+func TestParseBitrateInvalid(t *testing.T) {
+	for _, s := range []string{"", "M", "10MM", "1.5X", "-1M", "NaN", "Inf", "1Mi2"} {
+		if b, err := ParseBitrate(s); err == nil {
+			t.Errorf("ParseBitrate(%q) = %v, expected an error", s, float64(b))
+		}
+	}
+}
+
+func TestBitrateString(t *testing.T) {
+	tests := []struct {
+		in   Bitrate
+		want string
+	}{
+		{0, "0"},
+		{100, "100"},
+		{0.5, "0.5"},
+		{1e3, "1K"},
+		{1536, "1.536K"},
+		{1e6, "1M"},
+		{1.5e6, "1.5M"},
+		{2.5e9, "2.5G"},
+		{1e12, "1T"},
+		{1e15, "1000T"},
+	}
+	for _, tt := range tests {
+		if got := tt.in.String(); got != tt.want {
+			t.Errorf("Bitrate(%v).String() = %q, expected %q", float64(tt.in), got, tt.want)
+		}
+	}
+}
+
+func TestBitrateRoundTrip(t *testing.T) {
+	for _, b := range []Bitrate{0, 1, 0.1, 999, 1e3, 1536, 1.5e6, 123456789, 1e6 / 3, 2.5 * (1 << 20), 10 * (1 << 30), 7.8e12} {
+		got, err := ParseBitrate(b.String())
+		if err != nil {
+			t.Errorf("ParseBitrate(%q): %v", b.String(), err)
+			continue
+		}
+		if got != b {
+			t.Errorf("ParseBitrate(%q) = %v, expected %v", b.String(), float64(got), float64(b))
+		}
+	}
+}
+
+func TestReadCSVBitrates(t *testing.T) {
+	ps, err := readCSV(strings.NewReader("Cycle,Bitrate,SendSeconds\n0,1.5M,1\n1,10Mi,2\n2,64Kbps,3\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Bitrate{1.5e6, 10 * (1 << 20), 64e3}
+	var got []Bitrate
+	for _, p := range ps {
+		got = append(got, p.Bitrate)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("bitrates %v, expected %v", got, want)
+	}
+}
+
+func TestReadCSVColumns(t *testing.T) {
+	tests := []struct {
+		name string
+		csv  string
+		want []Problem
+	}{
+		{
+			name: "missing bitrate",
+			csv:  "Cycle,SendSeconds,WaitMilliSeconds\n0,1,1000\n",
+			want: []Problem{{Cycle: -1, Field: "Bitrate", Message: "missing column"}},
+		},
+		{
+			name: "unknown column",
+			csv:  "Cycle,Bitrate,SendSeconds,Burst\n0,1M,1,10\n",
+			want: []Problem{{Cycle: -1, Field: "Burst", Message: "unknown column"}},
+		},
+		{
+			name: "both",
+			csv:  "Cycle,Rate,SendSeconds\n0,1M,1\n",
+			want: []Problem{
+				{Cycle: -1, Field: "Rate", Message: "unknown column"},
+				{Cycle: -1, Field: "Bitrate", Message: "missing column"},
+			},
+		},
+		{
+			name: "invalid bitrate",
+			csv:  "Cycle,Bitrate,SendSeconds\n0,1M,1\n1,10MM,1\n2,,1\n",
+			want: []Problem{
+				{Cycle: 1, Field: "Bitrate", Message: `invalid bitrate "10MM"`},
+				{Cycle: 2, Field: "Bitrate", Message: `invalid bitrate ""`},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readCSV(strings.NewReader(tt.csv))
+			var ve *ValidationError
+			if !errors.As(err, &ve) {
+				t.Fatalf("error %v, expected a *ValidationError", err)
+			}
+			if !reflect.DeepEqual(ve.Problems, tt.want) {
+				t.Errorf("problems %v, expected %v", ve.Problems, tt.want)
+			}
+		})
+	}
+}
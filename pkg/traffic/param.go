@@ -1,25 +1,134 @@
 package traffic
 
 import (
+	"crypto/sha256"
 	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
 	"os"
+	"sort"
 	"strconv"
 
 	"github.com/chez-shanpu/traffic-generator/pkg/file"
 )
 
-type Bitrate string
 type Second int64
 type MilliSecond int64
 
 type Param struct {
-	Bitrate          Bitrate
-	SendSeconds      Second
-	WaitMilliSeconds MilliSecond
+	// Flow identifies the flow the cycle belongs to. Cycles of a flow run one after another,
+	// cycles of different flows run concurrently.
+	Flow        int     `csv:"Flow" json:"flow,omitempty" yaml:"flow,omitempty"`
+	Bitrate     Bitrate `csv:"Bitrate" json:"bitrate" yaml:"bitrate"`
+	SendSeconds Second  `csv:"SendSeconds" json:"send_seconds,omitempty" yaml:"send_seconds,omitempty"`
+	// FlowBytes is the size of the flow the cycle sends. If it is positive the cycle sends that many bytes
+	// instead of sending for SendSeconds, which is then the expected time to send them at the bitrate.
+	FlowBytes         int64       `csv:"FlowBytes" json:"flow_bytes,omitempty" yaml:"flow_bytes,omitempty"`
+	WaitMilliSeconds  MilliSecond `csv:"WaitMilliSeconds" json:"wait_milliseconds,omitempty" yaml:"wait_milliseconds,omitempty"`
+	StartMilliSeconds MilliSecond `csv:"StartMilliSeconds" json:"start_milliseconds,omitempty" yaml:"start_milliseconds,omitempty"`
+	State             string      `csv:"State" json:"state,omitempty" yaml:"state,omitempty"`
+	// SrcAddr is the host which runs the cycle in a plan of many sources.
+	SrcAddr string `csv:"SrcAddr" json:"src_addr,omitempty" yaml:"src_addr,omitempty"`
+	// DstAddr and DstPort override the destination of the run for the cycle.
+	DstAddr string `csv:"DstAddr" json:"dst_addr,omitempty" yaml:"dst_addr,omitempty"`
+	DstPort string `csv:"DstPort" json:"dst_port,omitempty" yaml:"dst_port,omitempty"`
+
+	// The following fields override the options of the run for the cycle if they are set. Mss, Flowlabel
+	// and Reverse are nil unless they are set, so that a cycle can turn the options off with 0 or false.
+	// Protocol is tcp or udp.
+	Protocol string `csv:"Protocol" json:"protocol,omitempty" yaml:"protocol,omitempty"`
+	Mss      *int64 `csv:"Mss" json:"mss,omitempty" yaml:"mss,omitempty"`
+	Window   string `csv:"Window" json:"window,omitempty" yaml:"window,omitempty"`
+	// Parallel is the number of streams, among which the bitrate of the cycle is divided.
+	Parallel  int    `csv:"Parallel" json:"parallel,omitempty" yaml:"parallel,omitempty"`
+	TOS       string `csv:"TOS" json:"tos,omitempty" yaml:"tos,omitempty"`
+	Flowlabel *int64 `csv:"Flowlabel" json:"flowlabel,omitempty" yaml:"flowlabel,omitempty"`
+	Reverse   *bool  `csv:"Reverse" json:"reverse,omitempty" yaml:"reverse,omitempty"`
 }
 
 type Params []*Param
 
+// Bytes returns the number of bytes the cycle sends.
+func (p Param) Bytes() int64 {
+	if p.FlowBytes > 0 {
+		return p.FlowBytes
+	}
+	return int64(float64(p.Bitrate) * float64(p.SendSeconds) / 8)
+}
+
+// SetFlowBytes makes the cycle send b bytes, with the send seconds it is expected to take at its bitrate.
+func (p *Param) SetFlowBytes(b int64) {
+	p.FlowBytes = b
+	s := Second(1)
+	if p.Bitrate > 0 {
+		s = Second(math.Ceil(float64(b) * 8 / float64(p.Bitrate)))
+	}
+	if s < 1 {
+		s = 1
+	}
+	p.SendSeconds = s
+}
+
+// Hash returns a digest of the cycles which identifies the plan.
+func (ps Params) Hash() string {
+	b, err := json.Marshal(ps)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// Schedule sets the start offset of every cycle from the send and wait durations of the previous ones.
+func (ps Params) Schedule() {
+	var start MilliSecond
+	for _, p := range ps {
+		p.StartMilliSeconds = start
+		start += MilliSecond(p.SendSeconds)*1000 + p.WaitMilliSeconds
+	}
+}
+
+// ByFlow splits the plan into its flows, ordered by flow identifier.
+func (ps Params) ByFlow() []Params {
+	flows := map[int]Params{}
+	var ids []int
+	for _, p := range ps {
+		if _, ok := flows[p.Flow]; !ok {
+			ids = append(ids, p.Flow)
+		}
+		flows[p.Flow] = append(flows[p.Flow], p)
+	}
+	sort.Ints(ids)
+
+	res := make([]Params, len(ids))
+	for i, id := range ids {
+		res[i] = flows[id]
+	}
+	return res
+}
+
+// Duration returns the time from the start of the plan to the end of its last cycle.
+func (ps Params) Duration() MilliSecond {
+	var d MilliSecond
+	for _, p := range ps {
+		if end := p.StartMilliSeconds + MilliSecond(p.SendSeconds)*1000; end > d {
+			d = end
+		}
+	}
+	return d
+}
+
+// TotalBytes returns the number of bytes the plan sends.
+func (ps Params) TotalBytes() int64 {
+	var b int64
+	for _, p := range ps {
+		b += p.Bytes()
+	}
+	return b
+}
+
 func (ps Params) Output(out string) error {
 	f, err := file.Create(out)
 	if err != nil {
@@ -32,7 +141,17 @@ func (ps Params) OutputCSV(f *os.File) error {
 	writer := csv.NewWriter(f)
 	defer writer.Flush()
 
-	csvHead := []string{"Cycle", "Bitrate", "SendSeconds", "WaitMilliSeconds"}
+	var cols []column
+	for _, c := range columns {
+		if c.set == nil || ps.has(c) {
+			cols = append(cols, c)
+		}
+	}
+
+	csvHead := []string{"Cycle"}
+	for _, c := range cols {
+		csvHead = append(csvHead, c.name)
+	}
 	if err := writer.Write(csvHead); err != nil {
 		return err
 	}
@@ -40,12 +159,140 @@ func (ps Params) OutputCSV(f *os.File) error {
 	for i, p := range ps {
 		var line []string
 		line = append(line, strconv.Itoa(i))
-		line = append(line, string(p.Bitrate))
-		line = append(line, strconv.FormatInt(int64(p.SendSeconds), 10))
-		line = append(line, strconv.FormatInt(int64(p.WaitMilliSeconds), 10))
+		for _, c := range cols {
+			line = append(line, c.value(p))
+		}
 		if err := writer.Write(line); err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+// column is a column of params CSV files. Optional columns, which have set, are written only if any
+// cycle sets them. Empty cells of columns other than Bitrate leave the field unset when parsed.
+type column struct {
+	name  string
+	value func(p *Param) string
+	set   func(p *Param) bool
+	parse func(p *Param, s string) error
+}
+
+var columns = []column{
+	{"Flow", func(p *Param) string { return strconv.Itoa(p.Flow) }, func(p *Param) bool { return p.Flow != 0 },
+		func(p *Param, s string) error { return parseSmallInt(s, &p.Flow) }},
+	{"Bitrate", func(p *Param) string { return p.Bitrate.String() }, nil,
+		func(p *Param, s string) (err error) { p.Bitrate, err = ParseBitrate(s); return }},
+	{"SendSeconds", func(p *Param) string { return strconv.FormatInt(int64(p.SendSeconds), 10) }, nil,
+		func(p *Param, s string) error { return parseInt(s, (*int64)(&p.SendSeconds)) }},
+	{"FlowBytes", func(p *Param) string { return strconv.FormatInt(p.FlowBytes, 10) }, func(p *Param) bool { return p.FlowBytes > 0 },
+		func(p *Param, s string) error { return parseInt(s, &p.FlowBytes) }},
+	{"WaitMilliSeconds", func(p *Param) string { return strconv.FormatInt(int64(p.WaitMilliSeconds), 10) }, nil,
+		func(p *Param, s string) error { return parseInt(s, (*int64)(&p.WaitMilliSeconds)) }},
+	{"StartMilliSeconds", func(p *Param) string { return strconv.FormatInt(int64(p.StartMilliSeconds), 10) }, nil,
+		func(p *Param, s string) error { return parseInt(s, (*int64)(&p.StartMilliSeconds)) }},
+	stringColumn("State", func(p *Param) *string { return &p.State }),
+	stringColumn("SrcAddr", func(p *Param) *string { return &p.SrcAddr }),
+	stringColumn("DstAddr", func(p *Param) *string { return &p.DstAddr }),
+	stringColumn("DstPort", func(p *Param) *string { return &p.DstPort }),
+	stringColumn("Protocol", func(p *Param) *string { return &p.Protocol }),
+	intColumn("Mss", func(p *Param) **int64 { return &p.Mss }),
+	stringColumn("Window", func(p *Param) *string { return &p.Window }),
+	{"Parallel", func(p *Param) string { return formatInt(int64(p.Parallel)) }, func(p *Param) bool { return p.Parallel != 0 },
+		func(p *Param, s string) error { return parseSmallInt(s, &p.Parallel) }},
+	stringColumn("TOS", func(p *Param) *string { return &p.TOS }),
+	intColumn("Flowlabel", func(p *Param) **int64 { return &p.Flowlabel }),
+	{"Reverse", func(p *Param) string { return formatBool(p.Reverse) }, func(p *Param) bool { return p.Reverse != nil },
+		func(p *Param, s string) error {
+			v, err := strconv.ParseBool(s)
+			if err != nil {
+				return fmt.Errorf("invalid boolean %q", s)
+			}
+			p.Reverse = &v
+			return nil
+		}},
+}
+
+// stringColumn is an optional column which is empty for the cycles which do not set it.
+func stringColumn(name string, field func(p *Param) *string) column {
+	return column{
+		name:  name,
+		value: func(p *Param) string { return *field(p) },
+		set:   func(p *Param) bool { return *field(p) != "" },
+		parse: func(p *Param, s string) error { *field(p) = s; return nil },
+	}
+}
+
+// intColumn is an optional column of an override which is empty for the cycles which do not set it.
+func intColumn(name string, field func(p *Param) **int64) column {
+	return column{
+		name: name,
+		value: func(p *Param) string {
+			if *field(p) == nil {
+				return ""
+			}
+			return strconv.FormatInt(**field(p), 10)
+		},
+		set: func(p *Param) bool { return *field(p) != nil },
+		parse: func(p *Param, s string) error {
+			var v int64
+			if err := parseInt(s, &v); err != nil {
+				return err
+			}
+			*field(p) = &v
+			return nil
+		},
+	}
+}
+
+// formatInt formats n, leaving zero, the value of an unset override, empty.
+func formatInt(n int64) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+func formatBool(b *bool) string {
+	if b == nil {
+		return ""
+	}
+	return strconv.FormatBool(*b)
+}
+
+func parseInt(s string, n *int64) error {
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid integer %q", s)
+	}
+	*n = v
+	return nil
+}
+
+func parseSmallInt(s string, n *int) error {
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("invalid integer %q", s)
+	}
+	*n = v
+	return nil
+}
+
+func (ps Params) has(c column) bool {
+	for _, p := range ps {
+		if c.set(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasFlowBytes reports whether any cycle of the plan is given by its flow size.
+func (ps Params) HasFlowBytes() bool {
+	for _, p := range ps {
+		if p.FlowBytes > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package traffic
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/chez-shanpu/traffic-generator/pkg/file"
+	"gopkg.in/yaml.v2"
+)
+
+// SchemaVersion is the version of the structure of JSON and YAML plans.
+const SchemaVersion = 1
+
+// Formats of params files.
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+)
+
+// Metadata describes how a plan was generated.
+type Metadata struct {
+	SchemaVersion int       `json:"schema_version" yaml:"schema_version"`
+	ToolVersion   string    `json:"tool_version,omitempty" yaml:"tool_version,omitempty"`
+	GeneratedAt   time.Time `json:"generated_at" yaml:"generated_at"`
+	Seed          uint64    `json:"seed" yaml:"seed"`
+	Model         string    `json:"model,omitempty" yaml:"model,omitempty"`
+	// Settings are the flags the plan was generated with, so that it can be generated again.
+	Settings map[string]string `json:"settings,omitempty" yaml:"settings,omitempty"`
+	// Transforms are the transformations applied to the plan by tg plan, in the order they were applied.
+	Transforms []string `json:"transforms,omitempty" yaml:"transforms,omitempty"`
+}
+
+// Plan is a params file with the metadata of its generation.
+// CSV params files carry the cycles only.
+type Plan struct {
+	Metadata Metadata `json:"metadata" yaml:"metadata"`
+	Cycles   Params   `json:"cycles" yaml:"cycles"`
+}
+
+// FormatOf returns the format of a params file from its extension. Files of other extensions are CSV.
+func FormatOf(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON
+	case ".yaml", ".yml":
+		return FormatYAML
+	}
+	return FormatCSV
+}
+
+// LoadPlan reads a params file in the format given by its extension.
+func LoadPlan(path string) (*Plan, error) {
+	p := &Plan{}
+	switch FormatOf(path) {
+	case FormatJSON, FormatYAML:
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		// the cycles are decoded as maps and parsed like the cells of CSV files, so that every problem of
+		// every cycle is reported instead of the first
+		var raw struct {
+			Metadata Metadata                 `json:"metadata" yaml:"metadata"`
+			Cycles   []map[string]interface{} `json:"cycles" yaml:"cycles"`
+		}
+		if FormatOf(path) == FormatJSON {
+			d := json.NewDecoder(bytes.NewReader(b))
+			d.DisallowUnknownFields()
+			d.UseNumber()
+			err = d.Decode(&raw)
+		} else {
+			err = yaml.UnmarshalStrict(b, &raw)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		p.Metadata = raw.Metadata
+		if p.Cycles, err = readCycles(raw.Cycles); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	default:
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if p.Cycles, err = readCSV(f); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	if p.Metadata.SchemaVersion > SchemaVersion {
+		return nil, fmt.Errorf("%s: schema version %d is newer than the supported version %d", path, p.Metadata.SchemaVersion, SchemaVersion)
+	}
+	return p, nil
+}
+
+// Output writes the plan to out, or to stdout if out is empty, in the given format.
+// An empty format is taken from the extension of out.
+func (p *Plan) Output(out, format string) error {
+	if format == "" {
+		format = FormatOf(out)
+	}
+	if format != FormatCSV && format != FormatJSON && format != FormatYAML {
+		return fmt.Errorf("unknown params format %q", format)
+	}
+
+	f, err := file.Create(out)
+	if err != nil {
+		return err
+	}
+	if f != os.Stdout {
+		defer f.Close()
+	}
+
+	switch format {
+	case FormatJSON:
+		e := json.NewEncoder(f)
+		e.SetIndent("", "  ")
+		return e.Encode(p)
+	case FormatYAML:
+		e := yaml.NewEncoder(f)
+		defer e.Close()
+		return e.Encode(p)
+	}
+	return p.Cycles.OutputCSV(f)
+}
@@ -23,10 +23,41 @@ THE SOFTWARE.
 package traffic
 
 type Result struct {
-	SendByte   int64
-	SendSecond float64
+	// Phase and Repeat are the phase of a scenario which ran the cycle and its repeat.
+	Phase      string  `json:"phase,omitempty"`
+	Repeat     int     `json:"repeat,omitempty"`
+	Cycle      int     `json:"cycle"`
+	Flow       int     `json:"flow,omitempty"`
+	SendByte   int64   `json:"send_byte"`
+	SendSecond float64 `json:"send_second"`
+	// CompletionSecond is the flow completion time reported by iperf3, from the start of the test until the
+	// receiver got the last byte. WallSecond is the time iperf3 ran, including connection setup and teardown.
+	CompletionSecond float64 `json:"completion_second"`
+	WallSecond       float64 `json:"wall_second"`
+	// PlannedStartSecond and StartSecond are the times from the start of the run at which the cycle was
+	// planned to start and started.
+	PlannedStartSecond float64 `json:"planned_start_second"`
+	StartSecond        float64 `json:"start_second"`
+	Status             string  `json:"status"`
+	// Error is the error iperf3 reported for a failed cycle.
+	Error string `json:"error,omitempty"`
 }
 
+// Statuses of cycles.
+const (
+	StatusOK      = "ok"
+	StatusSkipped = "skipped"
+	// StatusInterrupted is the status of a cycle whose iperf3 was stopped by interrupting the run.
+	StatusInterrupted = "interrupted"
+
+	// Statuses of failed cycles. StatusError is the status of failures of other kinds.
+	StatusConnectRefused = "connect-refused"
+	StatusServerBusy     = "server-busy"
+	StatusTimeout        = "timeout"
+	StatusParseError     = "parse-error"
+	StatusError          = "error"
+)
+
 type Results []*Result
 
 func (rs Results) TotalSendBytes() int64 {
@@ -44,3 +75,44 @@ func (rs Results) TotalSendSeconds() float64 {
 	}
 	return res
 }
+
+func (rs Results) TotalCompletionSeconds() float64 {
+	var res float64
+	for _, r := range rs {
+		res += r.CompletionSecond
+	}
+	return res
+}
+
+func (rs Results) TotalWallSeconds() float64 {
+	var res float64
+	for _, r := range rs {
+		res += r.WallSecond
+	}
+	return res
+}
+
+// Started reports whether iperf3 was run for the cycle.
+func (r Result) Started() bool {
+	return r.Status != StatusSkipped
+}
+
+// Failed reports whether iperf3 failed to run the cycle.
+func (r Result) Failed() bool {
+	switch r.Status {
+	case StatusOK, StatusSkipped, StatusInterrupted:
+		return false
+	}
+	return true
+}
+
+// Failures returns the number of failed cycles, not counting cycles without results.
+func (rs Results) Failures() int {
+	n := 0
+	for _, r := range rs {
+		if r != nil && r.Failed() {
+			n++
+		}
+	}
+	return n
+}
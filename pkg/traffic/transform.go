@@ -0,0 +1,245 @@
+package traffic
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"golang.org/x/exp/rand"
+)
+
+// Starts returns the time every cycle starts when every cycle takes its send seconds: its start offset or
+// the end of the wait of the previous cycle of its flow, whichever is later, like tg run schedules it.
+func (ps Params) Starts() []MilliSecond {
+	starts := make([]MilliSecond, len(ps))
+	next := map[int]MilliSecond{}
+	for i, p := range ps {
+		s := next[p.Flow]
+		if p.StartMilliSeconds > s {
+			s = p.StartMilliSeconds
+		}
+		starts[i] = s
+		next[p.Flow] = s + MilliSecond(p.SendSeconds)*1000 + p.WaitMilliSeconds
+	}
+	return starts
+}
+
+// Runtime returns the time the plan takes to run when every cycle takes its send seconds.
+func (ps Params) Runtime() MilliSecond {
+	var d MilliSecond
+	for i, s := range ps.Starts() {
+		if end := s + MilliSecond(ps[i].SendSeconds)*1000; end > d {
+			d = end
+		}
+	}
+	return d
+}
+
+// copyParams returns copies of the cycles, so that transformations leave their input alone.
+func (ps Params) copyParams() Params {
+	res := make(Params, len(ps))
+	for i, p := range ps {
+		c := *p
+		res[i] = &c
+	}
+	return res
+}
+
+// Scale multiplies the bitrates, the send durations and the idle times of the plan by their factors.
+// Idle times are the waits and the time before the first cycle of every flow. Flow sizes are scaled
+// with the send durations, and send seconds are rounded up to whole seconds.
+func (ps Params) Scale(bitrate, send, wait float64) (Params, error) {
+	for _, f := range []float64{bitrate, send, wait} {
+		if f <= 0 || math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("scale factors must be positive")
+		}
+	}
+
+	starts := ps.Starts()
+	res := ps.copyParams()
+	end := map[int]MilliSecond{}
+	newEnd := map[int]MilliSecond{}
+	for i, p := range res {
+		idle := starts[i] - end[p.Flow]
+		start := newEnd[p.Flow] + scaleMilliSeconds(idle, wait)
+		end[p.Flow] = starts[i] + MilliSecond(p.SendSeconds)*1000
+
+		p.Bitrate = Bitrate(float64(p.Bitrate) * bitrate)
+		if p.FlowBytes > 0 {
+			p.SetFlowBytes(int64(math.Round(float64(p.FlowBytes) * send)))
+		} else {
+			p.SendSeconds = scaleSeconds(p.SendSeconds, send)
+		}
+		p.WaitMilliSeconds = scaleMilliSeconds(p.WaitMilliSeconds, wait)
+		p.StartMilliSeconds = start
+		newEnd[p.Flow] = start + MilliSecond(p.SendSeconds)*1000
+	}
+	return res, nil
+}
+
+// compressTolerance is the relative error of the runtime of a compressed plan which Compress accepts.
+const compressTolerance = 0.1
+
+// Compress shortens the runtime of the plan by the factor. Send durations and the idle times before every cycle,
+// its wait and its start offset, are divided by the factor and bitrates multiplied by it, so that every cycle sends
+// about as many bytes as before and flows of a given size keep their size. As send durations are rounded up to
+// whole seconds of at least 1, the runtime may miss the target, and Compress returns an error if it misses it by
+// more than compressTolerance.
+func (ps Params) Compress(factor float64) (Params, error) {
+	if factor <= 0 || math.IsNaN(factor) || math.IsInf(factor, 0) {
+		return nil, fmt.Errorf("compression factor must be positive")
+	}
+
+	starts := ps.Starts()
+	res := ps.copyParams()
+	end := map[int]MilliSecond{}
+	newEnd := map[int]MilliSecond{}
+	for i, p := range res {
+		idle := starts[i] - end[p.Flow]
+		start := newEnd[p.Flow] + scaleMilliSeconds(idle, 1/factor)
+		end[p.Flow] = starts[i] + MilliSecond(p.SendSeconds)*1000
+
+		if p.FlowBytes > 0 {
+			p.Bitrate = Bitrate(float64(p.Bitrate) * factor)
+			p.SetFlowBytes(p.FlowBytes)
+		} else {
+			b := p.Bytes()
+			p.SendSeconds = scaleSeconds(p.SendSeconds, 1/factor)
+			p.Bitrate = Bitrate(math.Round(float64(b) * 8 / float64(p.SendSeconds)))
+		}
+		p.WaitMilliSeconds = scaleMilliSeconds(p.WaitMilliSeconds, 1/factor)
+		p.StartMilliSeconds = start
+		newEnd[p.Flow] = start + MilliSecond(p.SendSeconds)*1000
+	}
+
+	if d := res.Runtime(); d > 0 {
+		got := float64(ps.Runtime()) / float64(d)
+		if math.Abs(got-factor) > compressTolerance*factor {
+			return nil, fmt.Errorf("the plan can be compressed %.2f times instead of %v times, as send durations are whole seconds of at least 1", got, factor)
+		}
+	}
+	return res, nil
+}
+
+// Concat runs the plans one after another. Every plan starts when the previous ones have ended, and flows
+// keep their identifiers, so that a flow of a plan continues the flow of the same identifier of the previous.
+func Concat(plans ...Params) Params {
+	var res Params
+	var offset MilliSecond
+	for _, ps := range plans {
+		starts := ps.Starts()
+		for i, p := range ps.copyParams() {
+			p.StartMilliSeconds = offset + starts[i]
+			res = append(res, p)
+		}
+		offset += ps.Runtime()
+	}
+	return res
+}
+
+// Interleave runs the plans concurrently. The flows of every plan are numbered after the flows of the
+// previous plans and the cycles are merged in the order of their start offsets.
+func Interleave(plans ...Params) Params {
+	var res Params
+	var base int
+	for _, ps := range plans {
+		starts := ps.Starts()
+		next := base
+		for i, p := range ps.copyParams() {
+			p.StartMilliSeconds = starts[i]
+			p.Flow += base
+			if p.Flow >= next {
+				next = p.Flow + 1
+			}
+			res = append(res, p)
+		}
+		base = next
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].StartMilliSeconds < res[j].StartMilliSeconds
+	})
+	return res
+}
+
+// SliceCycles returns the cycles from index from to index to, both included, starting at 0.
+// A negative to means the last cycle.
+func (ps Params) SliceCycles(from, to int) (Params, error) {
+	if to < 0 || to >= len(ps) {
+		to = len(ps) - 1
+	}
+	if from < 0 || from > to {
+		return nil, fmt.Errorf("the plan of %d cycles has no cycles %d-%d", len(ps), from, to)
+	}
+
+	starts := ps.Starts()
+	res := ps[from : to+1].copyParams()
+	for i, p := range res {
+		p.StartMilliSeconds = starts[from+i] - starts[from]
+	}
+	return res, nil
+}
+
+// SliceTime returns the cycles which start in the time window [from, to) of the plan, starting at the
+// beginning of the window. A negative to means the end of the plan.
+func (ps Params) SliceTime(from, to MilliSecond) (Params, error) {
+	if from < 0 || (to >= 0 && to <= from) {
+		return nil, fmt.Errorf("invalid time window")
+	}
+
+	starts := ps.Starts()
+	var res Params
+	for i, p := range ps.copyParams() {
+		if starts[i] < from || (to >= 0 && starts[i] >= to) {
+			continue
+		}
+		p.StartMilliSeconds = starts[i] - from
+		res = append(res, p)
+	}
+	if len(res) == 0 {
+		return nil, fmt.Errorf("no cycles start in the time window")
+	}
+	return res, nil
+}
+
+// Shuffle randomly reorders the cycles of every flow and schedules them again from the start of the flow,
+// every cycle starting after the send and wait durations of the previous ones.
+func (ps Params) Shuffle(seed uint64) Params {
+	r := rand.New(rand.NewSource(seed))
+	first := map[int]MilliSecond{}
+	for i, s := range ps.Starts() {
+		if _, ok := first[ps[i].Flow]; !ok {
+			first[ps[i].Flow] = s
+		}
+	}
+
+	var res Params
+	for _, f := range ps.ByFlow() {
+		start := first[f[0].Flow]
+		f = f.copyParams()
+		r.Shuffle(len(f), func(i, j int) { f[i], f[j] = f[j], f[i] })
+		for _, p := range f {
+			p.StartMilliSeconds = start
+			start += MilliSecond(p.SendSeconds)*1000 + p.WaitMilliSeconds
+		}
+		res = append(res, f...)
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].StartMilliSeconds < res[j].StartMilliSeconds
+	})
+	return res
+}
+
+// scaleSeconds scales a send duration, rounding up to whole seconds of at least 1.
+func scaleSeconds(s Second, f float64) Second {
+	res := Second(math.Ceil(float64(s)*f - 1e-9))
+	if res < 1 {
+		res = 1
+	}
+	return res
+}
+
+func scaleMilliSeconds(ms MilliSecond, f float64) MilliSecond {
+	return MilliSecond(math.Round(float64(ms) * f))
+}
@@ -0,0 +1,282 @@
+package traffic
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits of iperf3 options.
+const (
+	MaxMss       = 9216
+	MaxParallel  = 128
+	MaxFlowlabel = 1<<20 - 1
+)
+
+var windowPattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?[KMGTkmgt]?$`)
+
+// Problem is a problem of a cycle of a plan. Problems of the whole plan have a Cycle of -1.
+type Problem struct {
+	Cycle   int
+	Field   string
+	Message string
+}
+
+func (p Problem) Error() string {
+	if p.Cycle < 0 {
+		return fmt.Sprintf("%s: %s", p.Field, p.Message)
+	}
+	return fmt.Sprintf("cycle %d: %s: %s", p.Cycle, p.Field, p.Message)
+}
+
+// ValidationError lists every problem found in a plan. Cycles are numbered like the Cycle column of CSV files,
+// from 0 at the row after the header.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	if len(e.Problems) == 1 {
+		b.WriteString("the plan has 1 problem:")
+	} else {
+		fmt.Fprintf(&b, "the plan has %d problems:", len(e.Problems))
+	}
+	for _, p := range e.Problems {
+		b.WriteString("\n  ")
+		b.WriteString(p.Error())
+	}
+	return b.String()
+}
+
+// RunOptions are the options of the run which cycles do not override, against which the plan is validated.
+type RunOptions struct {
+	UDP  bool
+	Mss  int64
+	IPv6 bool
+	// Flowlabel is the flow label of the run, which applies to IPv6 only.
+	Flowlabel int64
+	// MaxDuration is the longest runtime of the plan, or 0 for no limit.
+	MaxDuration MilliSecond
+}
+
+// readCSV reads the cycles of a params CSV file, collecting the problems of every cell.
+func readCSV(r io.Reader) (Params, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	var problems []Problem
+	cols := make([]*column, len(records[0]))
+	hasBitrate := false
+	for i, name := range records[0] {
+		if name == "Cycle" {
+			continue
+		}
+		if cols[i] = columnOf(name); cols[i] == nil {
+			problems = append(problems, Problem{Cycle: -1, Field: name, Message: "unknown column"})
+		}
+		hasBitrate = hasBitrate || name == "Bitrate"
+	}
+	if !hasBitrate {
+		problems = append(problems, Problem{Cycle: -1, Field: "Bitrate", Message: "missing column"})
+	}
+
+	ps := make(Params, len(records)-1)
+	for i, rec := range records[1:] {
+		p := &Param{}
+		for j, s := range rec {
+			c := cols[j]
+			if c == nil || (s == "" && c.name != "Bitrate") {
+				continue
+			}
+			if err := c.parse(p, s); err != nil {
+				problems = append(problems, Problem{Cycle: i, Field: c.name, Message: err.Error()})
+			}
+		}
+		ps[i] = p
+	}
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+	return ps, nil
+}
+
+// readCycles reads the cycles of a JSON or YAML plan, decoded as maps from the keys of the fields of Param to
+// their values, collecting the problems of every value like readCSV.
+func readCycles(raw []map[string]interface{}) (Params, error) {
+	keys := map[string]string{}
+	t := reflect.TypeOf(Param{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		keys[strings.Split(f.Tag.Get("json"), ",")[0]] = f.Tag.Get("csv")
+	}
+
+	var problems []Problem
+	ps := make(Params, len(raw))
+	for i, m := range raw {
+		names := make([]string, 0, len(m))
+		for k := range m {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+
+		p := &Param{}
+		for _, k := range names {
+			c := columnOf(keys[k])
+			if c == nil {
+				problems = append(problems, Problem{Cycle: i, Field: k, Message: "unknown field"})
+				continue
+			}
+			var s string
+			switch v := m[k].(type) {
+			case nil:
+				continue
+			case string:
+				s = v
+			case json.Number:
+				s = v.String()
+			case bool:
+				s = strconv.FormatBool(v)
+			case int:
+				s = strconv.Itoa(v)
+			case int64:
+				s = strconv.FormatInt(v, 10)
+			case uint64:
+				s = strconv.FormatUint(v, 10)
+			case float64:
+				s = strconv.FormatFloat(v, 'f', -1, 64)
+			default:
+				problems = append(problems, Problem{Cycle: i, Field: k, Message: "must be a single value"})
+				continue
+			}
+			if err := c.parse(p, s); err != nil {
+				problems = append(problems, Problem{Cycle: i, Field: k, Message: err.Error()})
+			}
+		}
+		ps[i] = p
+	}
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+	return ps, nil
+}
+
+// columnOf returns the column of the given name, or nil.
+func columnOf(name string) *column {
+	for i := range columns {
+		if columns[i].name == name {
+			return &columns[i]
+		}
+	}
+	return nil
+}
+
+// Validate checks every cycle of the plan for values which iperf3 would reject or misinterpret, start offsets
+// which go back in time within a flow, overrides which do not apply to the protocol of the cycle, and the
+// runtime of the plan. It returns a *ValidationError listing all problems.
+func (ps Params) Validate(o RunOptions) error {
+	var problems []Problem
+	add := func(i int, field, format string, args ...interface{}) {
+		problems = append(problems, Problem{Cycle: i, Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	prev := map[int]int{}
+	for i, p := range ps {
+		if b := float64(p.Bitrate); b < 0 || math.IsNaN(b) || math.IsInf(b, 0) {
+			add(i, "Bitrate", "must be a finite non-negative number")
+		}
+		if p.SendSeconds < 0 {
+			add(i, "SendSeconds", "must not be negative")
+		} else if p.SendSeconds == 0 && p.FlowBytes == 0 {
+			add(i, "SendSeconds", "must be positive unless FlowBytes is set (iperf3 sends for 10 seconds by default)")
+		}
+		if p.FlowBytes < 0 {
+			add(i, "FlowBytes", "must not be negative")
+		}
+		if p.WaitMilliSeconds < 0 {
+			add(i, "WaitMilliSeconds", "must not be negative")
+		}
+		if p.StartMilliSeconds < 0 {
+			add(i, "StartMilliSeconds", "must not be negative")
+		}
+		if p.Flow < 0 {
+			add(i, "Flow", "must not be negative")
+		}
+		if j, ok := prev[p.Flow]; ok && p.StartMilliSeconds < ps[j].StartMilliSeconds {
+			add(i, "StartMilliSeconds", "%d is before the start %d of cycle %d of flow %d", p.StartMilliSeconds, ps[j].StartMilliSeconds, j, p.Flow)
+		}
+		prev[p.Flow] = i
+
+		if p.DstPort != "" {
+			if n, err := strconv.Atoi(p.DstPort); err != nil || n < 1 || n > 65535 {
+				add(i, "DstPort", "%q is not a port number", p.DstPort)
+			}
+		}
+
+		udp := o.UDP
+		switch strings.ToLower(p.Protocol) {
+		case "":
+		case "tcp":
+			udp = false
+		case "udp":
+			udp = true
+		default:
+			add(i, "Protocol", "%q is neither tcp nor udp", p.Protocol)
+		}
+		mss := o.Mss
+		if p.Mss != nil {
+			mss = *p.Mss
+			if mss < 0 || mss > MaxMss {
+				add(i, "Mss", "must be between 1 and %d, or 0 for the default of iperf3", MaxMss)
+			}
+		}
+		if udp && mss != 0 {
+			add(i, "Mss", "the maximum segment size applies to tcp only")
+		}
+		if p.Window != "" && !windowPattern.MatchString(p.Window) {
+			add(i, "Window", "%q is not a size such as 256K", p.Window)
+		}
+		if p.Parallel < 0 || p.Parallel > MaxParallel {
+			add(i, "Parallel", "must be between 1 and %d", MaxParallel)
+		}
+		if p.TOS != "" {
+			if n, err := strconv.ParseInt(p.TOS, 0, 64); err != nil || n < 0 || n > 255 {
+				add(i, "TOS", "%q is not a type of service between 0 and 255", p.TOS)
+			}
+		}
+		flowlabel := o.Flowlabel
+		if p.Flowlabel != nil {
+			flowlabel = *p.Flowlabel
+			if flowlabel < 0 || flowlabel > MaxFlowlabel {
+				add(i, "Flowlabel", "must be between 1 and %d, or 0 for no flow label", MaxFlowlabel)
+			}
+		}
+		if flowlabel > 0 && !o.IPv6 {
+			add(i, "Flowlabel", "the flow label applies to ipv6 only")
+		}
+	}
+
+	if o.MaxDuration > 0 && len(problems) == 0 {
+		if d := ps.Runtime(); d > o.MaxDuration {
+			add(-1, "runtime", "%s exceeds the maximum of %s", time.Duration(d)*time.Millisecond, time.Duration(o.MaxDuration)*time.Millisecond)
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package traffic
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func int64Ptr(n int64) *int64 {
+	return &n
+}
+
+// validParam returns a cycle which has no problems, to which a test case adds one.
+func validParam(change func(p *Param)) *Param {
+	p := &Param{Bitrate: 1e6, SendSeconds: 1, WaitMilliSeconds: 1000}
+	if change != nil {
+		change(p)
+	}
+	return p
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		ps   Params
+		o    RunOptions
+		// want lists the field of every problem, prefixed with its cycle
+		want []string
+	}{
+		{"valid", Params{validParam(nil), validParam(nil)}, RunOptions{}, nil},
+		{"bitrate", Params{validParam(func(p *Param) { p.Bitrate = Bitrate(math.Inf(1)) })}, RunOptions{}, []string{"0 Bitrate"}},
+		{"negative send", Params{validParam(func(p *Param) { p.SendSeconds = -1 })}, RunOptions{}, []string{"0 SendSeconds"}},
+		{"zero send", Params{validParam(func(p *Param) { p.SendSeconds = 0 })}, RunOptions{}, []string{"0 SendSeconds"}},
+		{"zero send of a flow size", Params{validParam(func(p *Param) { p.SendSeconds, p.FlowBytes = 0, 1000 })}, RunOptions{}, nil},
+		{"flow bytes", Params{validParam(func(p *Param) { p.FlowBytes = -1 })}, RunOptions{}, []string{"0 FlowBytes"}},
+		{"wait", Params{validParam(func(p *Param) { p.WaitMilliSeconds = -1 })}, RunOptions{}, []string{"0 WaitMilliSeconds"}},
+		{"start", Params{validParam(func(p *Param) { p.StartMilliSeconds = -1 })}, RunOptions{}, []string{"0 StartMilliSeconds"}},
+		{"flow", Params{validParam(func(p *Param) { p.Flow = -1 })}, RunOptions{}, []string{"0 Flow"}},
+		{
+			"start before the previous cycle of the flow",
+			Params{
+				validParam(func(p *Param) { p.StartMilliSeconds = 5000 }),
+				validParam(func(p *Param) { p.Flow, p.StartMilliSeconds = 1, 0 }),
+				validParam(func(p *Param) { p.StartMilliSeconds = 4000 }),
+			},
+			RunOptions{},
+			[]string{"2 StartMilliSeconds"},
+		},
+		{"dst port", Params{validParam(func(p *Param) { p.DstPort = "65536" })}, RunOptions{}, []string{"0 DstPort"}},
+		{"protocol", Params{validParam(func(p *Param) { p.Protocol = "sctp" })}, RunOptions{}, []string{"0 Protocol"}},
+		{"mss", Params{validParam(func(p *Param) { p.Mss = int64Ptr(MaxMss + 1) })}, RunOptions{}, []string{"0 Mss"}},
+		{"mss of udp", Params{validParam(func(p *Param) { p.Protocol = "udp" })}, RunOptions{Mss: 1400}, []string{"0 Mss"}},
+		{"mss of tcp cycle of a udp run", Params{validParam(func(p *Param) { p.Protocol = "tcp" })}, RunOptions{UDP: true, Mss: 1400}, nil},
+		{"window", Params{validParam(func(p *Param) { p.Window = "256X" })}, RunOptions{}, []string{"0 Window"}},
+		{"parallel", Params{validParam(func(p *Param) { p.Parallel = MaxParallel + 1 })}, RunOptions{}, []string{"0 Parallel"}},
+		{"tos", Params{validParam(func(p *Param) { p.TOS = "0x100" })}, RunOptions{}, []string{"0 TOS"}},
+		{"flowlabel", Params{validParam(func(p *Param) { p.Flowlabel = int64Ptr(MaxFlowlabel + 1) })}, RunOptions{IPv6: true}, []string{"0 Flowlabel"}},
+		{"flowlabel of ipv4", Params{validParam(nil)}, RunOptions{Flowlabel: 1}, []string{"0 Flowlabel"}},
+		{"runtime", Params{validParam(nil), validParam(nil)}, RunOptions{MaxDuration: 2000}, []string{"-1 runtime"}},
+		{
+			"every problem",
+			Params{
+				validParam(func(p *Param) { p.SendSeconds, p.WaitMilliSeconds = -1, -1 }),
+				validParam(nil),
+				validParam(func(p *Param) { p.Protocol = "icmp" }),
+			},
+			RunOptions{},
+			[]string{"0 SendSeconds", "0 WaitMilliSeconds", "2 Protocol"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.ps.Validate(tt.o)
+			var got []string
+			var ve *ValidationError
+			if errors.As(err, &ve) {
+				for _, p := range ve.Problems {
+					got = append(got, fmt.Sprintf("%d %s", p.Cycle, p.Field))
+				}
+			} else if err != nil {
+				t.Fatalf("error %v, expected a *ValidationError", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("problems %v, expected %v (%v)", got, tt.want, err)
+			}
+		})
+	}
+}